@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/academic/gURL/src"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// certFormat is the output format of the cert command, text or json. Its
+	// flag is --format <text|json>.
+	certFormat = "text"
+
+	// certWarnDays makes the cert command exit with 2 when a certificate of
+	// the chain expires within that many days. Its flag is --warn-days <days>.
+	certWarnDays = 0
+)
+
+var cmdCert = &cobra.Command{
+	Use:   "cert [url]",
+	Short: "Show the certificate chain of the server at the specified URL",
+	Long: `Connect to the server at the specified URL with the same TLS, proxy and
+connection options as a request, and show the certificate chain it presents
+and whether it verifies.
+
+Exit codes: 0 for a valid chain, 1 for connection errors, invalid chains and
+--pinnedpubkey or --cert-status failures, which --insecure doesn't skip, 2 when
+a certificate expires within --warn-days days.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		URL = args[0]
+		os.Exit(inspectCertificates(URL, os.Stdout, os.Stderr))
+	},
+}
+
+// certificateInfo describes one certificate of the chain.
+type certificateInfo struct {
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	Serial             string    `json:"serial"`
+	SANs               []string  `json:"sans"`
+	KeyType            string    `json:"key_type"`
+	KeyBits            int       `json:"key_bits"`
+	SignatureAlgorithm string    `json:"signature_algorithm"`
+	NotBefore          time.Time `json:"not_before"`
+	NotAfter           time.Time `json:"not_after"`
+	DaysLeft           int       `json:"days_left"`
+	IsCA               bool      `json:"is_ca"`
+	OCSPServers        []string  `json:"ocsp_servers"`
+	CRLURLs            []string  `json:"crl_urls"`
+}
+
+// chainReport is the output of the cert command.
+type chainReport struct {
+	Address      string            `json:"address"`
+	TLSVersion   string            `json:"tls_version"`
+	CipherSuite  string            `json:"cipher_suite"`
+	Verified     bool              `json:"verified"` // false with --insecure
+	Valid        bool              `json:"valid"`
+	VerifyError  string            `json:"verify_error,omitempty"`
+	PolicyError  string            `json:"policy_error,omitempty"` // --pinnedpubkey or --cert-status, even with --insecure
+	Certificates []certificateInfo `json:"certificates"`
+}
+
+// inspectCertificates runs the cert command and returns its exit code.
+func inspectCertificates(rawUrl string, stdout, stderr io.Writer) int {
+	fail := func(err error) int {
+		if !silent {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+		}
+		return 1
+	}
+	if certFormat != "text" && certFormat != "json" {
+		return fail(fmt.Errorf("unknown --format %q, use text or json", certFormat))
+	}
+	if err := checkFlags(); err != nil {
+		return fail(err)
+	}
+	applyConnectionFlags()
+
+	if !strings.Contains(rawUrl, "://") {
+		rawUrl = "https://" + rawUrl
+	}
+	chain, err := c.CertificateChain(rawUrl)
+	if err != nil {
+		return fail(err)
+	}
+	report := newChainReport(chain, time.Now())
+
+	if certFormat == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		writeChainText(stdout, report)
+	}
+	return certExitCode(report, certWarnDays, stderr)
+}
+
+func newChainReport(chain *src.CertificateChain, now time.Time) chainReport {
+	report := chainReport{
+		Address:     chain.Address,
+		TLSVersion:  tls.VersionName(chain.TLSVersion),
+		CipherSuite: tls.CipherSuiteName(chain.CipherSuite),
+		Verified:    chain.Verified,
+		Valid:       chain.Verified && chain.VerifyError == nil,
+	}
+	if chain.VerifyError != nil {
+		report.VerifyError = chain.VerifyError.Error()
+	}
+	if chain.PolicyError != nil {
+		report.Valid = false
+		report.PolicyError = chain.PolicyError.Error()
+	}
+	for _, cert := range chain.Certificates {
+		report.Certificates = append(report.Certificates, newCertificateInfo(cert, now))
+	}
+	return report
+}
+
+func newCertificateInfo(cert *x509.Certificate, now time.Time) certificateInfo {
+	info := certificateInfo{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		Serial:             fmt.Sprintf("%X", cert.SerialNumber),
+		SANs:               append([]string{}, cert.DNSNames...),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		NotBefore:          cert.NotBefore.UTC(),
+		NotAfter:           cert.NotAfter.UTC(),
+		DaysLeft:           int(math.Floor(cert.NotAfter.Sub(now).Hours() / 24)),
+		IsCA:               cert.IsCA,
+		OCSPServers:        cert.OCSPServer,
+		CRLURLs:            cert.CRLDistributionPoints,
+	}
+	for _, ip := range cert.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+	info.SANs = append(info.SANs, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		info.SANs = append(info.SANs, uri.String())
+	}
+
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		info.KeyType, info.KeyBits = "RSA", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		info.KeyType, info.KeyBits = "ECDSA "+key.Curve.Params().Name, key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		info.KeyType, info.KeyBits = "Ed25519", 256
+	default:
+		info.KeyType = cert.PublicKeyAlgorithm.String()
+	}
+	return info
+}
+
+func writeChainText(w io.Writer, report chainReport) {
+	fmt.Fprintf(w, "Server:      %s\n", report.Address)
+	fmt.Fprintf(w, "Connection:  %s, %s\n", report.TLSVersion, report.CipherSuite)
+	switch {
+	case !report.Verified:
+		fmt.Fprintf(w, "Validation:  skipped (--insecure)\n")
+	case report.VerifyError != "":
+		fmt.Fprintf(w, "Validation:  FAILED, %s\n", report.VerifyError)
+	default:
+		fmt.Fprintf(w, "Validation:  OK\n")
+	}
+	if report.PolicyError != "" {
+		fmt.Fprintf(w, "Pin/OCSP:    FAILED, %s\n", report.PolicyError)
+	}
+
+	for i, cert := range report.Certificates {
+		fmt.Fprintf(w, "\nCertificate %d\n", i)
+		fmt.Fprintf(w, "  Subject:     %s\n", cert.Subject)
+		fmt.Fprintf(w, "  Issuer:      %s\n", cert.Issuer)
+		fmt.Fprintf(w, "  Serial:      %s\n", cert.Serial)
+		if len(cert.SANs) > 0 {
+			fmt.Fprintf(w, "  SANs:        %s\n", strings.Join(cert.SANs, ", "))
+		}
+		fmt.Fprintf(w, "  Key:         %s, %d bits\n", cert.KeyType, cert.KeyBits)
+		fmt.Fprintf(w, "  Signature:   %s\n", cert.SignatureAlgorithm)
+		fmt.Fprintf(w, "  Not before:  %s\n", cert.NotBefore.Format(time.RFC3339))
+		if cert.DaysLeft < 0 {
+			fmt.Fprintf(w, "  Not after:   %s (expired %d days ago)\n", cert.NotAfter.Format(time.RFC3339), -cert.DaysLeft)
+		} else {
+			fmt.Fprintf(w, "  Not after:   %s (%d days left)\n", cert.NotAfter.Format(time.RFC3339), cert.DaysLeft)
+		}
+		if cert.IsCA {
+			fmt.Fprintf(w, "  CA:          yes\n")
+		}
+		for _, ocsp := range cert.OCSPServers {
+			fmt.Fprintf(w, "  OCSP:        %s\n", ocsp)
+		}
+		for _, crl := range cert.CRLURLs {
+			fmt.Fprintf(w, "  CRL:         %s\n", crl)
+		}
+	}
+}
+
+// certExitCode is 1 for an invalid chain or a failed pin or OCSP check, and
+// 2 when a certificate expires within warnDays days, which are reported on
+// stderr.
+func certExitCode(report chainReport, warnDays int, stderr io.Writer) int {
+	if report.Verified && !report.Valid || report.PolicyError != "" {
+		return 1
+	}
+	code := 0
+	for _, cert := range report.Certificates {
+		if warnDays > 0 && cert.DaysLeft < warnDays {
+			if !silent {
+				fmt.Fprintf(stderr, "Warning: certificate %q expires in %d days, on %s\n",
+					cert.Subject, cert.DaysLeft, cert.NotAfter.Format(time.DateOnly))
+			}
+			code = 2
+		}
+	}
+	return code
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/academic/gURL/src"
+)
+
+func TestChainReport(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(255),
+		Subject:               pkix.Name{CommonName: "server"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(10*24*time.Hour + time.Hour),
+		DNSNames:              []string{"example.com"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		OCSPServer:            []string{"http://ocsp.example.com"},
+		CRLDistributionPoints: []string{"http://crl.example.com/ca.crl"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := newChainReport(&src.CertificateChain{
+		Address:      "example.com:443",
+		Certificates: []*x509.Certificate{cert},
+		Verified:     true,
+	}, now)
+	info := report.Certificates[0]
+	if !report.Valid || info.Serial != "FF" || info.KeyType != "ECDSA P-256" || info.KeyBits != 256 ||
+		info.DaysLeft != 10 || len(info.SANs) != 2 || info.SANs[1] != "127.0.0.1" ||
+		info.SignatureAlgorithm != "ECDSA-SHA256" || info.OCSPServers[0] != "http://ocsp.example.com" ||
+		info.CRLURLs[0] != "http://crl.example.com/ca.crl" {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	for warnDays, expected := range map[int]int{0: 0, 10: 0, 11: 2} {
+		if code := certExitCode(report, warnDays, io.Discard); code != expected {
+			t.Errorf("--warn-days %d: expected exit code %d, got %d", warnDays, expected, code)
+		}
+	}
+	report.Valid = false
+	if code := certExitCode(report, 0, io.Discard); code != 1 {
+		t.Errorf("invalid chain: expected exit code 1, got %d", code)
+	}
+
+	// A pin mismatch fails even with --insecure
+	report = newChainReport(&src.CertificateChain{
+		Certificates: []*x509.Certificate{cert},
+		PolicyError:  src.ErrPinnedPubKey,
+	}, now)
+	var text strings.Builder
+	writeChainText(&text, report)
+	if !strings.Contains(text.String(), "Pin/OCSP:    FAILED, "+src.ErrPinnedPubKey.Error()) {
+		t.Errorf("the pin error isn't shown:\n%s", text.String())
+	}
+	if code := certExitCode(report, 0, io.Discard); code != 1 {
+		t.Errorf("pin mismatch with --insecure: expected exit code 1, got %d", code)
+	}
+}
@@ -9,9 +9,15 @@ import (
 
 const defaultPort = "1080"
 
-// proxyCmd parses proxy url and adds default port number if not exists.
+// proxyCmd parses proxy url and adds default port number if not exists,
+// 443 for https:// proxies.
 func proxyCmd(proxy string) (string, error) {
-	u, err := url.Parse(proxy)
+	withScheme := proxy
+	if !strings.Contains(proxy, "://") {
+		// host:port would otherwise parse as a scheme
+		withScheme = "http://" + proxy
+	}
+	u, err := url.Parse(withScheme)
 	if err != nil {
 		err = fmt.Errorf("not valid proxy address: %s", err.Error())
 		return "", err
@@ -20,11 +26,49 @@ func proxyCmd(proxy string) (string, error) {
 		if proxy[len(proxy)-1] != ':' {
 			proxy += ":"
 		}
-		proxy += defaultPort
+		if u.Scheme == "https" {
+			proxy += "443"
+		} else {
+			proxy += defaultPort
+		}
 	}
 	return proxy, nil
 }
 
+// socksCmd handles the "--socks4", "--socks4a", "--socks5" and
+// "--socks5-hostname" flags, which take host[:port] without a scheme.
+func socksCmd(scheme, host string) (string, error) {
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	return proxyCmd(scheme + "://" + host)
+}
+
+// proxyTLSCmd applies the TLS settings for HTTPS proxies.
+func proxyTLSCmd() error {
+	c.SetProxyInsecure(proxyInsecure)
+	c.SetProxyCACert(proxyCACert)
+	c.SetProxyCAPath(proxyCAPath)
+	c.SetProxyCRLFile(proxyCRLFile)
+	if proxyCert != "" {
+		certFile, password := certPasswordCmd(proxyCert)
+		if password == "" {
+			password = proxyKeyPassword
+		}
+		c.SetProxyCert(certFile, proxyKey)
+		c.SetProxyCertTypes(proxyCertType, proxyKeyType)
+		c.SetProxyKeyPassword(password)
+	}
+	c.SetProxyPinnedPubKey(proxyPinnedPubKey)
+
+	minVersion, maxVersion, err := tlsVersionRangeCmd(proxyTLSv12, proxyTLSv13, proxyTLSMax, "--proxy-tls-max")
+	if err != nil {
+		return err
+	}
+	c.SetProxyTLSVersion(minVersion, maxVersion)
+	return nil
+}
+
 // proxyUserCmd handles "--proxy-user" related tasks. Returns
 // encoded with Base64 string.
 func proxyUserCmd(proxyUser string) (string, error) {
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// supportedProtocols are the url schemes gURL can transfer.
+var supportedProtocols = []string{"http", "https"}
+
+// protoRedirCmd parses a curl style protocol list as used by --proto-redir,
+// e.g. "=https" or "-all,+https", starting from the default set.
+func protoRedirCmd(protoRedir string, defaults []string) ([]string, error) {
+	enabled := make(map[string]bool)
+	for _, p := range defaults {
+		enabled[p] = true
+	}
+	for _, item := range strings.Split(protoRedir, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		modifier := byte('+')
+		if item[0] == '+' || item[0] == '-' || item[0] == '=' {
+			modifier, item = item[0], item[1:]
+		}
+		protocols := []string{item}
+		if item == "all" {
+			protocols = supportedProtocols
+		} else if !isSupportedProtocol(item) {
+			return nil, fmt.Errorf("unsupported protocol in --proto-redir: %s", item)
+		}
+		if modifier == '=' {
+			enabled = make(map[string]bool)
+		}
+		for _, p := range protocols {
+			enabled[p] = modifier != '-'
+		}
+	}
+
+	var ret []string
+	for _, p := range supportedProtocols {
+		if enabled[p] {
+			ret = append(ret, p)
+		}
+	}
+	return ret, nil
+}
+
+func isSupportedProtocol(protocol string) bool {
+	for _, p := range supportedProtocols {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
@@ -22,8 +23,29 @@ var (
 	includeHeaders  bool
 	followRedirects bool
 	maxRedirects    int
+	post301         bool
+	post302         bool
+	post303         bool
+	locationTrusted bool
+	protoRedir      string
 	timeout         int
 	connectTimeout  int
+	resolve         []string
+	connectTo       []string
+	dnsServers      string
+	dohURL          string
+	dohInsecure     bool
+	ipv4            bool
+	ipv6            bool
+	eyeballsTimeout int
+	iface           string
+	localPort       string
+	tcpNoDelay      bool
+	keepaliveTime   int
+	noKeepalive     bool
+	tcpFastOpen     bool
+	unixSocket      string
+	abstractSocket  string
 	cookieJar       string
 	compressed      bool
 	userAgent       string
@@ -37,6 +59,10 @@ var (
 	http10          bool
 	http11          bool
 	http2           bool
+	http2Prior      bool
+	http09          bool
+	http3Only       bool
+	altSvc          string
 	http3           bool
 )
 
@@ -126,30 +152,24 @@ func executeRequest(httpMethod, url string) {
 		os.Exit(1)
 	}
 
-	// Apply timeout if specified
-	if timeout > 0 {
-		c.SetTimeout(time.Duration(timeout) * time.Second)
-	}
-
-	// Apply connect timeout if specified
-	if connectTimeout > 0 {
-		c.SetConnectTimeout(time.Duration(connectTimeout) * time.Second)
-	}
+	applyConnectionFlags()
 
-	// Set HTTP version
-	if http10 {
-		c.SetHTTPVersion("1.0")
-	} else if http11 {
-		c.SetHTTPVersion("1.1")
-	} else if http2 {
-		c.SetHTTPVersion("2")
-	} else if http3 {
-		c.SetHTTPVersion("3")
+	// Set redirect policy
+	if followRedirects || locationTrusted {
+		c.SetFollowRedirects(true)
+		c.SetMaxRedirects(maxRedirects)
+		c.SetPostRedirects(post301, post302, post303)
+		c.SetLocationTrusted(locationTrusted)
 	}
-
-	// Set insecure mode
-	if insecure {
-		c.SetInsecure(true)
+	if protoRedir != "" {
+		protocols, err := protoRedirCmd(protoRedir, supportedProtocols)
+		if err != nil {
+			if !silent {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			os.Exit(1)
+		}
+		c.SetRedirectProtocols(protocols)
 	}
 
 	// Handle cookies
@@ -265,7 +285,12 @@ func executeRequest(httpMethod, url string) {
 
 	if err != nil {
 		if !silent {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			var proxyErr *src.ProxyAuthError
+			if errors.As(err, &proxyErr) {
+				fmt.Fprintf(os.Stderr, "Proxy authentication failed: %v\n", err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
 		}
 		os.Exit(1)
 	}
@@ -273,6 +298,78 @@ func executeRequest(httpMethod, url string) {
 	handleResponse(response, httpMethod, url)
 }
 
+// applyConnectionFlags applies the flags about how to connect, shared by
+// requests and the cert command.
+func applyConnectionFlags() {
+	// Describe connections and proxy choices on stderr
+	if verbose && !silent {
+		c.SetVerbose(os.Stderr)
+	}
+
+	// Apply timeout if specified
+	if timeout > 0 {
+		c.SetTimeout(time.Duration(timeout) * time.Second)
+	}
+
+	// Apply connect timeout if specified
+	if connectTimeout > 0 {
+		c.SetConnectTimeout(time.Duration(connectTimeout) * time.Second)
+	}
+
+	// Override where host names connect to
+	c.SetResolve(resolve)
+	c.SetConnectTo(connectTo)
+
+	// Pick the resolver and the address family
+	c.SetDNSServers(dnsServers)
+	c.SetDoHURL(dohURL)
+	c.SetDoHInsecure(dohInsecure)
+	if ipv4 {
+		c.SetIPVersion("4")
+	} else if ipv6 {
+		c.SetIPVersion("6")
+	}
+	if eyeballsTimeout > 0 {
+		c.SetHappyEyeballsTimeout(time.Duration(eyeballsTimeout) * time.Millisecond)
+	}
+
+	// Source address and socket options
+	c.SetInterface(iface)
+	c.SetLocalPort(localPort)
+	c.SetTCPNoDelay(tcpNoDelay)
+	c.SetKeepAliveTime(time.Duration(keepaliveTime) * time.Second)
+	c.SetNoKeepAlive(noKeepalive)
+	c.SetTCPFastOpen(tcpFastOpen)
+	if unixSocket != "" {
+		c.SetUnixSocket(unixSocket)
+	} else if abstractSocket != "" {
+		c.SetAbstractUnixSocket(abstractSocket)
+	}
+
+	// Set HTTP version
+	if http10 {
+		c.SetHTTPVersion("1.0")
+	} else if http11 {
+		c.SetHTTPVersion("1.1")
+	} else if http2Prior {
+		c.SetHTTP2PriorKnowledge(true)
+	} else if http2 {
+		c.SetHTTPVersion("2")
+	} else if http3Only {
+		c.SetHTTP3Only(true)
+	} else if http3 {
+		c.SetHTTPVersion("3")
+	}
+
+	c.SetHTTP09Allowed(http09)
+	c.SetAltSvc(altSvc)
+
+	// Set insecure mode
+	if insecure {
+		c.SetInsecure(true)
+	}
+}
+
 func handleResponse(response *src.Response, httpMethod string, requestURL string) {
 	var output io.Writer = os.Stdout
 
@@ -289,10 +386,18 @@ func handleResponse(response *src.Response, httpMethod string, requestURL string
 		output = file
 	}
 
+	// Show the redirect chain if verbose
+	if verbose && !silent {
+		for _, redirect := range response.Redirects {
+			fmt.Fprintf(os.Stderr, "* %s %s returned %d, following to %s\n",
+				redirect.Method, redirect.URL, redirect.StatusCode, redirect.Location)
+		}
+	}
+
 	// Show headers if requested or verbose
 	if includeHeaders || verbose || httpMethod == "HEAD" {
 		if verbose {
-			fmt.Fprintf(output, "< HTTP/1.1 %d\n", response.StatusCode)
+			fmt.Fprintf(output, "< %s %d\n", response.Proto, response.StatusCode)
 		}
 		for key, value := range response.Header.Mapper {
 			if verbose {
@@ -34,6 +34,83 @@ var (
 	// proxyNegotiate is the flag variable whether indicates command contains --proxy-negotiate flag.
 	proxyNegotiate = false
 
+	// proxyAnyAuth is the flag variable whether indicates command contains --proxy-anyauth flag.
+	// The strongest scheme the proxy offers is picked.
+	proxyAnyAuth = false
+
+	// proxyPAC is the PAC file or url whose FindProxyForURL picks the proxy of
+	// each request. Its flag is --proxy-pac <file|url>, --proxy wins over it.
+	proxyPAC = ""
+
+	// noProxy is the comma separated list of hosts that don't use a proxy. Its flag is
+	// --noproxy <no-proxy-list> and it replaces the NO_PROXY environment variable.
+	noProxy = ""
+
+	// proxyTunnel is the flag variable whether indicates command contains --proxytunnel flag.
+	// Plain http:// requests then go through a CONNECT tunnel too.
+	proxyTunnel = false
+
+	// HTTPS proxy TLS settings, independent of the ones for the origin.
+	// --proxy-cacert <file>, --proxy-capath <dir>, --proxy-crlfile <file>, --proxy-insecure, --proxy-cert <cert[:passwd]>, --proxy-key <key>,
+	// --proxy-cert-type <type>, --proxy-key-type <type>, --proxy-pass <phrase>,
+	// --proxy-pinnedpubkey <hashes>, --proxy-tlsv1.2, --proxy-tlsv1.3 and --proxy-tls-max <VERSION>.
+	proxyCACert       = ""
+	proxyCAPath       = ""
+	proxyCRLFile      = ""
+	proxyInsecure     = false
+	proxyCert         = ""
+	proxyKey          = ""
+	proxyCertType     = ""
+	proxyKeyType      = ""
+	proxyKeyPassword  = ""
+	proxyPinnedPubKey = ""
+	proxyTLSv12       = false
+	proxyTLSv13       = false
+	proxyTLSMax       = ""
+
+	// socks4, socks4a, socks5 and socks5Hostname are the host[:port] of a SOCKS
+	// proxy given with --socks4, --socks4a, --socks5 and --socks5-hostname. They
+	// take precedence over --proxy.
+	socks4         = ""
+	socks4a        = ""
+	socks5         = ""
+	socks5Hostname = ""
+
+	// Handshake settings for the origin server. Their flags are --tlsv1.2, --tlsv1.3,
+	// --tls-max <VERSION>, --ciphers <list>, --tls13-ciphers <list>, --curves <list>
+	// and --no-alpn.
+	tlsv12       = false
+	tlsv13       = false
+	tlsMax       = ""
+	ciphers      = ""
+	tls13Ciphers = ""
+	curves       = ""
+	noALPN       = false
+
+	// keyLogFile is where TLS secrets are written for Wireshark. Its flag is
+	// --keylog-file <file>, the SSLKEYLOGFILE environment variable is used without it.
+	keyLogFile = ""
+
+	// ech is the ECHConfigList for Encrypted Client Hello, a file, base64 or
+	// "auto" for the HTTPS DNS record. Its flag is --ech <config|auto>.
+	ech = ""
+
+	// Trust settings for the origin server. Their flags are --cacert <file>,
+	// --capath <dir>, --crlfile <file>, --pinnedpubkey <hashes> and --cert-status.
+	caCert       = ""
+	caPath       = ""
+	crlFile      = ""
+	pinnedPubKey = ""
+	certStatus   = false
+
+	// Client certificate for the origin server. Its flags are -E, --cert <file[:password]>,
+	// --key <key>, --cert-type <type>, --key-type <type> and --pass <phrase>.
+	cert        = ""
+	keyFile     = ""
+	certType    = ""
+	keyType     = ""
+	keyPassword = ""
+
 	// Authentication variables
 	// basic is the flag variable whether indicates command contains --basic flag.
 	basic = false
@@ -104,6 +181,11 @@ func Execute() {
 	rootCmd.AddCommand(cmdHead)
 	rootCmd.AddCommand(cmdOptions)
 	rootCmd.AddCommand(cmdPatch)
+	rootCmd.AddCommand(cmdCert)
+
+	// cert command flags
+	cmdCert.Flags().StringVar(&certFormat, "format", "text", "<text|json> Output format")
+	cmdCert.Flags().IntVar(&certWarnDays, "warn-days", 0, "<days> Exit with 2 if a certificate expires within days")
 
 	// Proxy flags
 	rootCmd.PersistentFlags().StringVarP(&proxy, "proxy", "x", "", "[protocol://]host[:port] Use this proxy")
@@ -112,6 +194,27 @@ func Execute() {
 	rootCmd.PersistentFlags().BoolVarP(&proxyDigest, "proxy-digest", "", false, "Use Digest authentication on the proxy")
 	rootCmd.PersistentFlags().BoolVarP(&proxyNTLM, "proxy-ntlm", "", false, "Use NTLM authentication on the proxy")
 	rootCmd.PersistentFlags().BoolVarP(&proxyNegotiate, "proxy-negotiate", "", false, "Use HTTP Negotiate (SPNEGO) authentication on the proxy")
+	rootCmd.PersistentFlags().BoolVarP(&proxyAnyAuth, "proxy-anyauth", "", false, "Pick any proxy authentication method")
+	rootCmd.PersistentFlags().StringVar(&proxyPAC, "proxy-pac", "", "<file|url> Use the proxy auto-config file")
+	rootCmd.PersistentFlags().StringVar(&noProxy, "noproxy", "", "<no-proxy-list> List of hosts which do not use proxy")
+	rootCmd.PersistentFlags().BoolVarP(&proxyTunnel, "proxytunnel", "p", false, "Operate through an HTTP proxy tunnel (using CONNECT)")
+	rootCmd.PersistentFlags().StringVar(&proxyCACert, "proxy-cacert", "", "<file> CA certificate to verify peer against for proxy")
+	rootCmd.PersistentFlags().StringVar(&proxyCAPath, "proxy-capath", "", "<dir> CA directory to verify peer against for proxy")
+	rootCmd.PersistentFlags().StringVar(&proxyCRLFile, "proxy-crlfile", "", "<file> Set a CRL list for proxy")
+	rootCmd.PersistentFlags().BoolVar(&proxyInsecure, "proxy-insecure", false, "Do HTTPS proxy connections without verifying the proxy")
+	rootCmd.PersistentFlags().StringVar(&proxyCert, "proxy-cert", "", "<cert> Set client certificate for proxy")
+	rootCmd.PersistentFlags().StringVar(&proxyKey, "proxy-key", "", "<key> Private key for HTTPS proxy")
+	rootCmd.PersistentFlags().StringVar(&proxyCertType, "proxy-cert-type", "", "<type> Client certificate type for HTTPS proxy (PEM/DER/P12)")
+	rootCmd.PersistentFlags().StringVar(&proxyKeyType, "proxy-key-type", "", "<type> Private key file type for proxy (PEM/DER)")
+	rootCmd.PersistentFlags().StringVar(&proxyKeyPassword, "proxy-pass", "", "<phrase> Pass phrase for the private key for HTTPS proxy")
+	rootCmd.PersistentFlags().StringVar(&proxyPinnedPubKey, "proxy-pinnedpubkey", "", "<hashes> FILE/HASHES public key to verify proxy with")
+	rootCmd.PersistentFlags().BoolVar(&proxyTLSv12, "proxy-tlsv1.2", false, "Use TLSv1.2 or greater for HTTPS proxies")
+	rootCmd.PersistentFlags().BoolVar(&proxyTLSv13, "proxy-tlsv1.3", false, "Use TLSv1.3 or greater for HTTPS proxies")
+	rootCmd.PersistentFlags().StringVar(&proxyTLSMax, "proxy-tls-max", "", "<VERSION> Set maximum allowed TLS version for HTTPS proxies")
+	rootCmd.PersistentFlags().StringVar(&socks4, "socks4", "", "<host[:port]> SOCKS4 proxy on given host + port")
+	rootCmd.PersistentFlags().StringVar(&socks4a, "socks4a", "", "<host[:port]> SOCKS4a proxy on given host + port")
+	rootCmd.PersistentFlags().StringVar(&socks5, "socks5", "", "<host[:port]> SOCKS5 proxy on given host + port")
+	rootCmd.PersistentFlags().StringVar(&socks5Hostname, "socks5-hostname", "", "<host[:port]> SOCKS5 proxy, pass host name to proxy")
 
 	// Authentication flags
 	rootCmd.PersistentFlags().BoolVar(&basic, "basic", false, "Use HTTP Basic Authentication")
@@ -133,11 +236,51 @@ func Execute() {
 	rootCmd.PersistentFlags().BoolVarP(&includeHeaders, "include", "i", false, "Include protocol response headers in the output")
 	rootCmd.PersistentFlags().BoolVarP(&followRedirects, "location", "L", false, "Follow redirects")
 	rootCmd.PersistentFlags().IntVarP(&maxRedirects, "max-redirs", "", 50, "Maximum number of redirects allowed")
+	rootCmd.PersistentFlags().BoolVar(&post301, "post301", false, "Do not switch to GET after following a 301")
+	rootCmd.PersistentFlags().BoolVar(&post302, "post302", false, "Do not switch to GET after following a 302")
+	rootCmd.PersistentFlags().BoolVar(&post303, "post303", false, "Do not switch to GET after following a 303")
+	rootCmd.PersistentFlags().BoolVar(&locationTrusted, "location-trusted", false, "Like --location, and send auth to other hosts")
+	rootCmd.PersistentFlags().StringVar(&protoRedir, "proto-redir", "", "Enable/disable PROTOCOLS on redirect")
 	rootCmd.PersistentFlags().IntVarP(&timeout, "max-time", "m", 0, "Maximum time allowed for the transfer")
 	rootCmd.PersistentFlags().IntVar(&connectTimeout, "connect-timeout", 0, "Maximum time allowed for connection")
+	rootCmd.PersistentFlags().StringArrayVar(&resolve, "resolve", nil, "<host:port:addr[,addr]> Resolve the host+port to this address")
+	rootCmd.PersistentFlags().StringArrayVar(&connectTo, "connect-to", nil, "<HOST1:PORT1:HOST2:PORT2> Connect to HOST2:PORT2 for requests to HOST1:PORT1")
+	rootCmd.PersistentFlags().StringVar(&dnsServers, "dns-servers", "", "<addresses> DNS server addrs to use, ip[:port] separated by commas")
+	rootCmd.PersistentFlags().StringVar(&dohURL, "doh-url", "", "<URL> Resolve host names over DoH")
+	rootCmd.PersistentFlags().BoolVar(&dohInsecure, "doh-insecure", false, "Allow insecure DoH server connections")
+	rootCmd.PersistentFlags().BoolVarP(&ipv4, "ipv4", "4", false, "Resolve names to IPv4 addresses")
+	rootCmd.PersistentFlags().BoolVarP(&ipv6, "ipv6", "6", false, "Resolve names to IPv6 addresses")
+	rootCmd.PersistentFlags().IntVar(&eyeballsTimeout, "happy-eyeballs-timeout-ms", 200, "<milliseconds> Time to try one address family before racing the other")
+	rootCmd.PersistentFlags().StringVar(&iface, "interface", "", "<name> Use network INTERFACE (or address)")
+	rootCmd.PersistentFlags().StringVar(&localPort, "local-port", "", "<num/range> Force use of RANGE for local port numbers")
+	rootCmd.PersistentFlags().BoolVar(&tcpNoDelay, "tcp-nodelay", true, "Use the TCP_NODELAY option")
+	rootCmd.PersistentFlags().IntVar(&keepaliveTime, "keepalive-time", 0, "<seconds> Interval time for keepalive probes")
+	rootCmd.PersistentFlags().BoolVar(&noKeepalive, "no-keepalive", false, "Disable TCP keepalive on the connection")
+	rootCmd.PersistentFlags().BoolVar(&tcpFastOpen, "tcp-fastopen", false, "Use TCP Fast Open (Linux)")
+	rootCmd.PersistentFlags().StringVar(&unixSocket, "unix-socket", "", "<path> Connect through this Unix domain socket")
+	rootCmd.PersistentFlags().StringVar(&abstractSocket, "abstract-unix-socket", "", "<path> Connect via abstract Unix domain socket (Linux)")
 	rootCmd.PersistentFlags().StringVarP(&userAgent, "user-agent", "A", "", "Send User-Agent <name> to server")
 	rootCmd.PersistentFlags().StringVarP(&referer, "referer", "e", "", "Referrer URL")
 	rootCmd.PersistentFlags().BoolVarP(&insecure, "insecure", "k", false, "Allow insecure server connections when using SSL")
+	rootCmd.PersistentFlags().BoolVar(&tlsv12, "tlsv1.2", false, "Use TLSv1.2 or greater")
+	rootCmd.PersistentFlags().BoolVar(&tlsv13, "tlsv1.3", false, "Use TLSv1.3 or greater")
+	rootCmd.PersistentFlags().StringVar(&tlsMax, "tls-max", "", "<VERSION> Set maximum allowed TLS version")
+	rootCmd.PersistentFlags().StringVar(&ciphers, "ciphers", "", "<list> SSL ciphers to use")
+	rootCmd.PersistentFlags().StringVar(&tls13Ciphers, "tls13-ciphers", "", "<list> TLS 1.3 cipher suites to use")
+	rootCmd.PersistentFlags().StringVar(&curves, "curves", "", "<list> (EC) TLS key exchange algorithm(s) to request")
+	rootCmd.PersistentFlags().BoolVar(&noALPN, "no-alpn", false, "Disable the ALPN TLS extension")
+	rootCmd.PersistentFlags().StringVar(&keyLogFile, "keylog-file", "", "<file> Write TLS secrets to file, like SSLKEYLOGFILE")
+	rootCmd.PersistentFlags().StringVar(&ech, "ech", "", "<config|auto> Encrypted Client Hello with an ECHConfigList file or base64, or the HTTPS DNS record")
+	rootCmd.PersistentFlags().StringVar(&caCert, "cacert", "", "<file> CA certificate to verify peer against")
+	rootCmd.PersistentFlags().StringVar(&caPath, "capath", "", "<dir> CA directory to verify peer against")
+	rootCmd.PersistentFlags().StringVar(&crlFile, "crlfile", "", "<file> Get a CRL list in PEM format from the given file")
+	rootCmd.PersistentFlags().StringVar(&pinnedPubKey, "pinnedpubkey", "", "<hashes> FILE/HASHES Public key to verify peer against")
+	rootCmd.PersistentFlags().BoolVar(&certStatus, "cert-status", false, "Verify the status of the server certificate")
+	rootCmd.PersistentFlags().StringVarP(&cert, "cert", "E", "", "<certificate[:password]> Client certificate file and password")
+	rootCmd.PersistentFlags().StringVar(&keyFile, "key", "", "<key> Private key file name")
+	rootCmd.PersistentFlags().StringVar(&certType, "cert-type", "", "<type> Certificate file type (PEM/DER/P12)")
+	rootCmd.PersistentFlags().StringVar(&keyType, "key-type", "", "<type> Private key file type (PEM/DER)")
+	rootCmd.PersistentFlags().StringVar(&keyPassword, "pass", "", "<phrase> Pass phrase for the private key")
 	rootCmd.PersistentFlags().StringVarP(&method, "request", "X", "", "Specify request command to use")
 	rootCmd.PersistentFlags().StringVarP(&uploadFile, "upload-file", "T", "", "Transfer local FILE to destination")
 	rootCmd.PersistentFlags().StringSliceVarP(&formData, "form", "F", []string{}, "Specify multipart MIME data")
@@ -146,10 +289,14 @@ func Execute() {
 	rootCmd.PersistentFlags().BoolVar(&compressed, "compressed", false, "Request compressed response")
 
 	// HTTP version flags
-	rootCmd.PersistentFlags().BoolVar(&http10, "http1.0", false, "Use HTTP 1.0")
+	rootCmd.PersistentFlags().BoolVarP(&http10, "http1.0", "0", false, "Use HTTP 1.0")
 	rootCmd.PersistentFlags().BoolVar(&http11, "http1.1", false, "Use HTTP 1.1")
 	rootCmd.PersistentFlags().BoolVar(&http2, "http2", false, "Use HTTP 2")
+	rootCmd.PersistentFlags().BoolVar(&http2Prior, "http2-prior-knowledge", false, "Use HTTP 2 without HTTP/1.1 Upgrade")
 	rootCmd.PersistentFlags().BoolVar(&http3, "http3", false, "Use HTTP 3")
+	rootCmd.PersistentFlags().BoolVar(&http3Only, "http3-only", false, "Use HTTP 3 only")
+	rootCmd.PersistentFlags().StringVar(&altSvc, "alt-svc", "", "<file name> Enable alt-svc with this cache file")
+	rootCmd.PersistentFlags().BoolVar(&http09, "http0.9", false, "Allow HTTP 0.9 responses")
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -166,13 +313,58 @@ func checkFlags() error {
 		}
 		c.SetProxy(proxy)
 	}
-	if proxyUser != "" {
-		proxyUserCredentials, err := proxyUserCmd(proxyUser)
+	if proxyPAC != "" {
+		c.SetProxyPAC(proxyPAC)
+	}
+	if noProxy != "" {
+		c.SetNoProxy(noProxy)
+	}
+	c.SetProxyTunnel(proxyTunnel)
+	if err := proxyTLSCmd(); err != nil {
+		return err
+	}
+	if err := tlsCmd(); err != nil {
+		return err
+	}
+	if err := certCmd(); err != nil {
+		return err
+	}
+	if err := src.CheckResolve(resolve); err != nil {
+		return err
+	}
+	if err := src.CheckConnectTo(connectTo); err != nil {
+		return err
+	}
+	for _, socks := range []struct{ scheme, host string }{
+		{"socks4", socks4},
+		{"socks4a", socks4a},
+		{"socks5", socks5},
+		{"socks5h", socks5Hostname},
+	} {
+		if socks.host == "" {
+			continue
+		}
+		proxy, err := socksCmd(socks.scheme, socks.host)
 		if err != nil {
 			return err
 		}
-		if !proxyNTLM && !proxyNegotiate && !proxyDigest { // Basic authentication
-			c.AddHeader("Proxy-Authenticate", fmt.Sprintf("Basic %s", proxyUserCredentials))
+		c.SetProxy(proxy)
+	}
+	if proxyUser != "" {
+		if err := checkProxyUser(proxyUser); err != nil {
+			return err
+		}
+		switch {
+		case proxyAnyAuth:
+			c.SetProxyAnyAuth(proxyUser)
+		case proxyNTLM:
+			c.SetProxyNTLMAuth(proxyUser)
+		case proxyDigest:
+			c.SetProxyDigestAuth(proxyUser)
+		case proxyNegotiate:
+			return fmt.Errorf("--proxy-negotiate is not supported yet")
+		default: // Basic authentication
+			c.SetProxyBasicAuth(proxyUser)
 		}
 	}
 	if len(cookies) > 0 {
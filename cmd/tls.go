@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// tlsVersions maps the version names used on the command line, e.g. by
+// --proxy-tls-max, to their crypto/tls constants.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsVersionCmd parses a TLS version name, "" means no bound.
+func tlsVersionCmd(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("unsupported TLS version %q, use 1.0, 1.1, 1.2 or 1.3", version)
+	}
+	return v, nil
+}
+
+// certPasswordCmd splits the "--cert <file[:password]>" argument. A colon in
+// the file name is escaped as "\:", and a Windows drive letter like "C:\" is
+// kept as part of the name.
+func certPasswordCmd(cert string) (file, password string) {
+	var name strings.Builder
+	for i := 0; i < len(cert); i++ {
+		switch {
+		case cert[i] == '\\' && i+1 < len(cert) && cert[i+1] == ':':
+			name.WriteByte(':')
+			i++
+		case cert[i] == ':' && i == 1 && isDriveLetter(cert[0]) &&
+			i+1 < len(cert) && (cert[i+1] == '\\' || cert[i+1] == '/'):
+			name.WriteByte(':')
+		case cert[i] == ':':
+			return name.String(), cert[i+1:]
+		default:
+			name.WriteByte(cert[i])
+		}
+	}
+	return name.String(), ""
+}
+
+func isDriveLetter(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+// tlsVersionRangeCmd turns the --tlsv1.2/--tlsv1.3 style flags and a
+// --tls-max style flag, named maxFlag in errors, into version bounds.
+func tlsVersionRangeCmd(v12, v13 bool, max, maxFlag string) (uint16, uint16, error) {
+	minVersion := uint16(0)
+	if v12 {
+		minVersion = tls.VersionTLS12
+	}
+	if v13 {
+		minVersion = tls.VersionTLS13
+	}
+	maxVersion, err := tlsVersionCmd(max)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", maxFlag, err)
+	}
+	if minVersion != 0 && maxVersion != 0 && minVersion > maxVersion {
+		return 0, 0, fmt.Errorf("%s %s is below the requested minimum TLS version", maxFlag, max)
+	}
+	return minVersion, maxVersion, nil
+}
+
+// tlsCmd applies the handshake and certificate verification flags for the
+// origin server.
+func tlsCmd() error {
+	minVersion, maxVersion, err := tlsVersionRangeCmd(tlsv12, tlsv13, tlsMax, "--tls-max")
+	if err != nil {
+		return err
+	}
+	c.SetTLSVersion(minVersion, maxVersion)
+	c.SetCiphers(ciphers)
+	c.SetTLS13Ciphers(tls13Ciphers)
+	c.SetCurves(curves)
+	c.SetNoALPN(noALPN)
+
+	c.SetCACert(caCert)
+	c.SetCAPath(caPath)
+	c.SetCRLFile(crlFile)
+	c.SetPinnedPubKey(pinnedPubKey)
+	c.SetCertStatus(certStatus)
+	c.SetKeyLogFile(keyLogFile)
+	c.SetECH(ech)
+	return nil
+}
+
+// certCmd applies the client certificate flags for the origin server. The
+// key flags need --cert, and a P12 bundle holds its own key.
+func certCmd() error {
+	if cert == "" {
+		for _, flag := range []struct{ name, value string }{
+			{"--key", keyFile},
+			{"--cert-type", certType},
+			{"--key-type", keyType},
+			{"--pass", keyPassword},
+		} {
+			if flag.value != "" {
+				return fmt.Errorf("%s needs --cert", flag.name)
+			}
+		}
+		return nil
+	}
+	if keyFile != "" && (strings.EqualFold(certType, "P12") || strings.EqualFold(certType, "PKCS12")) {
+		return errors.New("--key can't be used with --cert-type P12, the key is in the bundle")
+	}
+	certFile, password := certPasswordCmd(cert)
+	if password == "" {
+		password = keyPassword
+	}
+	c.SetCrt(certFile, keyFile)
+	c.SetCertTypes(certType, keyType)
+	c.SetKeyPassword(password)
+	return nil
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestCertPasswordCmd(t *testing.T) {
+	tests := map[string][2]string{
+		"client.pem":            {"client.pem", ""},
+		"client.p12:secret":     {"client.p12", "secret"},
+		"client.p12:se:cret":    {"client.p12", "se:cret"},
+		`my\:cert.pem:secret`:   {"my:cert.pem", "secret"},
+		`C:\certs\client.p12:x`: {`C:\certs\client.p12`, "x"},
+		"C:/certs/client.pem":   {"C:/certs/client.pem", ""},
+	}
+	for cert, expected := range tests {
+		file, password := certPasswordCmd(cert)
+		if file != expected[0] || password != expected[1] {
+			t.Errorf("%s: expected file %q password %q, got %q %q", cert, expected[0], expected[1], file, password)
+		}
+	}
+}
+
+func TestTLSVersionRangeCmd(t *testing.T) {
+	minVersion, maxVersion, err := tlsVersionRangeCmd(true, false, "1.3", "--tls-max")
+	if err != nil || minVersion != tls.VersionTLS12 || maxVersion != tls.VersionTLS13 {
+		t.Errorf("unexpected range %x-%x, %v", minVersion, maxVersion, err)
+	}
+	if _, _, err := tlsVersionRangeCmd(false, true, "1.2", "--tls-max"); err == nil {
+		t.Error("--tlsv1.3 with --tls-max 1.2 should be rejected")
+	}
+	if _, _, err := tlsVersionRangeCmd(false, false, "2.0", "--tls-max"); err == nil {
+		t.Error("unknown TLS version should be rejected")
+	}
+}
+
+func TestCertCmd(t *testing.T) {
+	defer func() { cert, keyFile, certType, keyType, keyPassword = "", "", "", "", "" }()
+	for _, flags := range []struct{ cert, key, certType, keyType, pass string }{
+		{key: "client.key"},
+		{certType: "DER"},
+		{keyType: "DER"},
+		{pass: "secret"},
+		{cert: "client.p12", key: "client.key", certType: "p12"},
+	} {
+		cert, keyFile, certType, keyType, keyPassword = flags.cert, flags.key, flags.certType, flags.keyType, flags.pass
+		if err := certCmd(); err == nil {
+			t.Errorf("%+v should be rejected", flags)
+		}
+	}
+	cert, keyFile, certType, keyType, keyPassword = "client.p12:secret", "", "P12", "", ""
+	if err := certCmd(); err != nil {
+		t.Errorf("a P12 bundle without --key: %v", err)
+	}
+}
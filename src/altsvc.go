@@ -0,0 +1,247 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// altSvcTimeLayout is how expiry times are written in the cache file.
+const altSvcTimeLayout = "20060102 15:04:05"
+
+// defaultAltSvcMaxAge is how long an alternative is kept without "ma".
+const defaultAltSvcMaxAge = 24 * time.Hour
+
+// altSvcEntry is an alternative service of an origin. The cache file has one
+// per line, in curl's format:
+//
+//	h2 example.com 443 h3 example.com 443 "20261018 10:00:00" 0 0
+type altSvcEntry struct {
+	srcALPN, srcHost, srcPort string // the origin, and the protocol it answered with
+	dstALPN, dstHost, dstPort string // the alternative
+	expires                   time.Time
+	persist                   bool
+}
+
+// parseAltSvcEntry parses a line of the cache file.
+func parseAltSvcEntry(line string) (altSvcEntry, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 10 {
+		return altSvcEntry{}, false
+	}
+	expires, err := time.Parse(altSvcTimeLayout, strings.Trim(fields[6]+" "+fields[7], `"`))
+	if err != nil {
+		return altSvcEntry{}, false
+	}
+	unbracket := func(host string) string { return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]") }
+	return altSvcEntry{
+		srcALPN: fields[0], srcHost: unbracket(fields[1]), srcPort: fields[2],
+		dstALPN: fields[3], dstHost: unbracket(fields[4]), dstPort: fields[5],
+		expires: expires,
+		persist: fields[8] == "1",
+	}, true
+}
+
+func (e altSvcEntry) String() string {
+	bracket := func(host string) string {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	persist := 0
+	if e.persist {
+		persist = 1
+	}
+	return fmt.Sprintf("%s %s %s %s %s %s %q %d 0", e.srcALPN, bracket(e.srcHost), e.srcPort,
+		e.dstALPN, bracket(e.dstHost), e.dstPort, e.expires.UTC().Format(altSvcTimeLayout), persist)
+}
+
+// parseAltSvc returns the alternatives in an Alt-Svc header of the origin
+// host:port, which answered over alpn. "clear" has none.
+func parseAltSvc(header, alpn, host, port string, now time.Time) []altSvcEntry {
+	var entries []altSvcEntry
+	for _, value := range strings.Split(header, ",") {
+		params := strings.Split(value, ";")
+		id, authority, ok := strings.Cut(strings.TrimSpace(params[0]), "=")
+		if !ok {
+			continue
+		}
+		altHost, altPort, err := net.SplitHostPort(strings.Trim(authority, `"`))
+		if err != nil {
+			continue
+		}
+		if altHost == "" {
+			altHost = host
+		}
+		entry := altSvcEntry{
+			srcALPN: alpn, srcHost: host, srcPort: port,
+			dstALPN: id, dstHost: altHost, dstPort: altPort,
+			expires: now.Add(defaultAltSvcMaxAge),
+		}
+		for _, param := range params[1:] {
+			key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+			val = strings.Trim(val, `"`)
+			switch strings.ToLower(key) {
+			case "ma":
+				if seconds, err := strconv.Atoi(val); err == nil {
+					entry.expires = now.Add(time.Duration(seconds) * time.Second)
+				}
+			case "persist":
+				entry.persist = val == "1"
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// altSvcCache holds the alternatives of --alt-svc, read from its file on
+// first use.
+type altSvcCache struct {
+	path    string
+	entries []altSvcEntry
+	loaded  bool
+}
+
+func (a *altSvcCache) load() error {
+	if a.loaded {
+		return nil
+	}
+	a.loaded = true
+	data, err := os.ReadFile(a.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if entry, ok := parseAltSvcEntry(line); ok {
+			a.entries = append(a.entries, entry)
+		}
+	}
+	return nil
+}
+
+// lookup returns the HTTP/3 alternative of the origin host:port.
+func (a *altSvcCache) lookup(host, port string, now time.Time) (altSvcEntry, bool, error) {
+	if err := a.load(); err != nil {
+		return altSvcEntry{}, false, err
+	}
+	for _, entry := range a.entries {
+		if strings.EqualFold(entry.srcHost, host) && entry.srcPort == port &&
+			entry.dstALPN == "h3" && entry.expires.After(now) {
+			return entry, true, nil
+		}
+	}
+	return altSvcEntry{}, false, nil
+}
+
+// update replaces the alternatives of the origin host:port with those of
+// its Alt-Svc header, and writes the cache file.
+func (a *altSvcCache) update(host, port, alpn, header string, now time.Time) error {
+	if err := a.load(); err != nil {
+		return err
+	}
+	kept := a.entries[:0]
+	for _, entry := range a.entries {
+		if !(strings.EqualFold(entry.srcHost, host) && entry.srcPort == port) && entry.expires.After(now) {
+			kept = append(kept, entry)
+		}
+	}
+	a.entries = append(kept, parseAltSvc(header, alpn, host, port, now)...)
+
+	var b strings.Builder
+	b.WriteString("# Alt-Svc cache, in curl's format\n")
+	for _, entry := range a.entries {
+		b.WriteString(entry.String() + "\n")
+	}
+	return os.WriteFile(a.path, []byte(b.String()), 0o600)
+}
+
+// httpsPort returns the port of an https:// url.
+func httpsPort(target *url.URL) string {
+	if port := target.Port(); port != "" {
+		return port
+	}
+	return "443"
+}
+
+// altSvcAlternative returns the host:port to try HTTP/3 at for target, from
+// the Alt-Svc cache, with --http3 too. It is "" when there is none, or the
+// request couldn't use HTTP/3 anyway.
+func (c *Client) altSvcAlternative(target *url.URL, proxyURL *url.URL) string {
+	if c.altSvc == nil || target.Scheme != "https" || c.unixSocket != "" ||
+		proxyURL != nil && !isSOCKS(proxyURL.Scheme) || c.originTLS.checkHTTPVersion("3") != nil {
+		return ""
+	}
+	origin := net.JoinHostPort(target.Hostname(), httpsPort(target))
+	entry, ok, err := c.altSvc.lookup(target.Hostname(), httpsPort(target), time.Now())
+	if err != nil {
+		c.infof("Alt-Svc cache %s: %v", c.altSvc.path, err)
+	}
+	if !ok {
+		return ""
+	}
+	alt := net.JoinHostPort(entry.dstHost, entry.dstPort)
+	c.infof("Alt-Svc: trying HTTP/3 at %s for %s", alt, origin)
+	return alt
+}
+
+// recordAltSvc keeps the Alt-Svc header of a response from an https://
+// origin in the cache.
+func (c *Client) recordAltSvc(rawUrl string, resp *Response) {
+	header := resp.Header.Get("Alt-Svc")
+	if c.altSvc == nil || header == "" {
+		return
+	}
+	target, err := url.Parse(rawUrl)
+	if err != nil || target.Scheme != "https" {
+		return
+	}
+	alpn := "h1"
+	switch resp.Proto {
+	case "HTTP/2":
+		alpn = "h2"
+	case "HTTP/3":
+		alpn = "h3"
+	}
+	if err := c.altSvc.update(target.Hostname(), httpsPort(target), alpn, header, time.Now()); err != nil {
+		c.infof("Alt-Svc cache %s: %v", c.altSvc.path, err)
+	}
+}
+
+// quicUnanswered tells whether a QUIC connection failed because nothing came
+// back, as when UDP is blocked, rather than for a reason TCP would share.
+func quicUnanswered(err error) bool {
+	var idle *quic.IdleTimeoutError
+	var handshake *quic.HandshakeTimeoutError
+	var opErr *net.OpError
+	return errors.As(err, &idle) || errors.As(err, &handshake) || errors.As(err, &opErr)
+}
+
+// fallbackRoundTrip sends a request over HTTP/3, or over the TCP transport
+// once QUIC got no answer.
+func (c *Client) fallbackRoundTrip(t *transport, url, method string, headers requestHeaders, body []byte) (*Response, error) {
+	if t.quicErr == nil {
+		resp, err := c.callHTTP2OrHTTP3(t, url, method, headers, body)
+		if t.quicErr == nil {
+			return resp, err
+		}
+		c.infof("HTTP/3 got no answer, %v, falling back to TCP", t.quicErr)
+	}
+	return c.roundTrip(t.tcp, url, method, headers, body)
+}
@@ -0,0 +1,118 @@
+package src
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAltSvc(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	entries := parseAltSvc(`h3=":8443"; ma=60, h2="alt.example:443"; persist=1, clear`, "h2", "example.com", "443", now)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	want := `h2 example.com 443 h3 example.com 8443 "20261017 12:01:00" 0 0`
+	if got := entries[0].String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if e := entries[1]; e.dstHost != "alt.example" || !e.persist || !e.expires.Equal(now.Add(defaultAltSvcMaxAge)) {
+		t.Errorf("got %+v", e)
+	}
+
+	line := `h1 [::1] 443 h3 [::1] 443 "20261017 12:00:00" 1 0`
+	entry, ok := parseAltSvcEntry(line)
+	if !ok || entry.srcHost != "::1" || entry.String() != line {
+		t.Errorf("%s parsed as %+v, %v", line, entry, ok)
+	}
+	if _, ok := parseAltSvcEntry("h3 example.com 443"); ok {
+		t.Error("a short line should be skipped")
+	}
+}
+
+func TestAltSvc(t *testing.T) {
+	serverCert, _, _ := writeTestCertificate(t, "server")
+	var h3Port string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Alt-Svc", `h3=":`+h3Port+`"; ma=3600`)
+	})
+	tcpURL, h3URL := newTestServers(t, &tls.Config{Certificates: []tls.Certificate{serverCert}}, handler)
+	_, h3Port, _ = net.SplitHostPort(strings.TrimPrefix(h3URL, "https://"))
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(tcpURL, "https://"))
+
+	// The first request learns the alternative, the next client reads it
+	// from the file and uses HTTP/3
+	cache := filepath.Join(t.TempDir(), "alt-svc.txt")
+	resp, err := NewClient().SetInsecure(true).SetAltSvc(cache).Get(tcpURL)
+	if err != nil || resp.Proto != "HTTP/1.1" {
+		t.Fatalf("got %v, %v", resp, err)
+	}
+	data, _ := os.ReadFile(cache)
+	if !strings.Contains(string(data), "h1 127.0.0.1 "+port+" h3 127.0.0.1 "+h3Port+" ") {
+		t.Errorf("the cache file doesn't have the alternative:\n%s", data)
+	}
+	var verbose bytes.Buffer
+	resp, err = NewClient().SetInsecure(true).SetAltSvc(cache).SetVerbose(&verbose).Get(tcpURL)
+	if err != nil || resp.Proto != "HTTP/3" {
+		t.Fatalf("got %v, %v, want an HTTP/3 response", resp, err)
+	}
+	if !strings.Contains(verbose.String(), "* Alt-Svc: trying HTTP/3 at 127.0.0.1:"+h3Port+" for 127.0.0.1:"+port+"\n") {
+		t.Errorf("verbose output doesn't show the alternative:\n%s", verbose.String())
+	}
+	for name, c := range map[string]*Client{
+		"--http3":      NewClient().SetHTTPVersion("3"),
+		"--http3-only": NewClient().SetHTTP3Only(true),
+	} {
+		resp, err = c.SetInsecure(true).SetAltSvc(cache).SetConnectTimeout(300 * time.Millisecond).Get(tcpURL)
+		if err != nil || resp.Proto != "HTTP/3" {
+			t.Errorf("%s got %v, %v, want an HTTP/3 response from the alternative", name, resp, err)
+		}
+	}
+
+	// An alternative that doesn't answer falls back to TCP
+	blackHole, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blackHole.Close()
+	deadPort := strconv.Itoa(blackHole.LocalAddr().(*net.UDPAddr).Port)
+	line := `h1 127.0.0.1 ` + port + ` h3 127.0.0.1 ` + deadPort + ` "` + time.Now().Add(time.Hour).UTC().Format(altSvcTimeLayout) + `" 0 0`
+	os.WriteFile(cache, []byte(line+"\n"), 0o600)
+	verbose.Reset()
+	resp, err = NewClient().SetInsecure(true).SetAltSvc(cache).SetConnectTimeout(300 * time.Millisecond).
+		SetVerbose(&verbose).Get(tcpURL)
+	if err != nil || resp.Proto != "HTTP/1.1" {
+		t.Fatalf("got %v, %v, want the TCP response", resp, err)
+	}
+	if !strings.Contains(verbose.String(), "falling back to TCP") {
+		t.Errorf("verbose output doesn't show the fallback:\n%s", verbose.String())
+	}
+}
+
+func TestHTTP3Fallback(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// UDP on the port of the server is dropped
+	blackHole, err := net.ListenPacket("udp", server.Listener.Addr().String())
+	if err != nil {
+		t.Skipf("can't take the UDP port of the server: %v", err)
+	}
+	defer blackHole.Close()
+
+	resp, err := NewClient().SetHTTPVersion("3").SetInsecure(true).SetConnectTimeout(300 * time.Millisecond).Get(server.URL)
+	if err != nil || resp.Proto != "HTTP/1.1" {
+		t.Errorf("--http3 got %v, %v, want the TCP response", resp, err)
+	}
+	if _, err := NewClient().SetHTTP3Only(true).SetInsecure(true).SetConnectTimeout(300 * time.Millisecond).Get(server.URL); err == nil {
+		t.Error("--http3-only should fail when QUIC gets no answer")
+	}
+}
@@ -0,0 +1,222 @@
+package src
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// authChallenge is one challenge of a WWW-Authenticate or Proxy-Authenticate
+// header, either carrying auth-params or a single token68.
+type authChallenge struct {
+	scheme  string
+	token68 string
+	params  map[string]string
+}
+
+// parseChallenges parses the values of WWW-Authenticate headers. A single
+// header value may hold more than one challenge.
+func parseChallenges(values []string) []authChallenge {
+	var ret []authChallenge
+	for _, value := range values {
+		ret = append(ret, parseChallengeHeader(value)...)
+	}
+	return ret
+}
+
+func parseChallengeHeader(s string) []authChallenge {
+	var ret []authChallenge
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return ret
+		}
+		name, rest := readToken(s)
+		if name == "" {
+			// skip an unexpected character
+			s = s[1:]
+			continue
+		}
+		rest = strings.TrimLeft(rest, " \t")
+		if strings.HasPrefix(rest, "=") && len(ret) > 0 {
+			var value string
+			value, s = readParamValue(rest[1:])
+			ret[len(ret)-1].params[strings.ToLower(name)] = value
+			continue
+		}
+
+		challenge := authChallenge{scheme: name, params: make(map[string]string)}
+		if token68, remaining, ok := readToken68(rest); ok {
+			challenge.token68 = token68
+			rest = remaining
+		}
+		ret = append(ret, challenge)
+		s = rest
+	}
+}
+
+// readToken reads an HTTP token from the start of s.
+func readToken(s string) (string, string) {
+	i := strings.IndexAny(s, " \t,=\"")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
+
+// readParamValue reads a token or quoted-string auth-param value.
+func readParamValue(s string) (string, string) {
+	s = strings.TrimLeft(s, " \t")
+	if !strings.HasPrefix(s, "\"") {
+		i := strings.IndexAny(s, " \t,")
+		if i < 0 {
+			return s, ""
+		}
+		return s[:i], s[i:]
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:]
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), ""
+}
+
+// readToken68 reads a token68 (e.g. base64 data) up to the next comma.
+func readToken68(s string) (string, string, bool) {
+	end := strings.IndexByte(s, ',')
+	if end < 0 {
+		end = len(s)
+	}
+	candidate := strings.TrimSpace(s[:end])
+	if candidate == "" {
+		return "", s, false
+	}
+	body := strings.TrimRight(candidate, "=")
+	if body == "" {
+		return "", s, false
+	}
+	for _, r := range body {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			strings.ContainsRune("-._~+/", r)) {
+			return "", s, false
+		}
+	}
+	return candidate, s[end:], true
+}
+
+// requestTarget returns the origin-form request target of a url.
+func requestTarget(rawUrl string) string {
+	if u, err := url.Parse(rawUrl); err == nil {
+		return u.RequestURI()
+	}
+	return rawUrl
+}
+
+// findChallenges returns the challenges of the given scheme.
+func findChallenges(challenges []authChallenge, scheme string) []authChallenge {
+	var ret []authChallenge
+	for _, challenge := range challenges {
+		if strings.EqualFold(challenge.scheme, scheme) {
+			ret = append(ret, challenge)
+		}
+	}
+	return ret
+}
+
+// send performs a single hop of a request through the first reachable of the
+// proxies selected for it.
+func (c *Client) send(rawUrl, method string, headers requestHeaders, body []byte, withAuth bool) (*Response, error) {
+	proxies, err := c.selectProxies(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	for i, proxyURL := range proxies {
+		t, err := c.newTransport(rawUrl, proxyURL)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.sendWith(t, rawUrl, method, headers, body, withAuth)
+		if err == nil {
+			c.recordAltSvc(rawUrl, resp)
+		}
+		var unreachable *proxyConnectError
+		if i == len(proxies)-1 || !errors.As(err, &unreachable) {
+			return resp, err
+		}
+		c.infof("%v, trying the next one", err)
+	}
+	return nil, errNoRoute
+}
+
+// sendWith performs a single hop of a request over t and answers
+// authentication challenges of schemes that need a round trip with the
+// server.
+func (c *Client) sendWith(t *transport, rawUrl, method string, headers requestHeaders, body []byte, withAuth bool) (*Response, error) {
+	if !withAuth {
+		return c.roundTrip(t, rawUrl, method, headers.withoutCredentials(), body)
+	}
+	if c.authType == "ntlm" {
+		return c.sendNTLM(t, rawUrl, method, headers, body)
+	}
+
+	hopHeaders := headers.clone()
+	c.addAuthenticationHeaders(hopHeaders, method, rawUrl, body)
+	resp, err := c.roundTrip(t, rawUrl, method, hopHeaders, body)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || c.authType != "digest" {
+		return resp, err
+	}
+
+	// Answer the digest challenge, and once more if the server only
+	// complained about a stale nonce.
+	for retry := 0; retry < 2; retry++ {
+		challenge, ok := pickDigestChallenge(parseChallenges(resp.wwwAuthenticate))
+		if !ok || (retry > 0 && !strings.EqualFold(challenge.params["stale"], "true")) {
+			break
+		}
+		c.digest = newDigestSession(challenge)
+
+		hopHeaders = headers.clone()
+		c.addAuthenticationHeaders(hopHeaders, method, rawUrl, body)
+		resp, err = c.roundTrip(t, rawUrl, method, hopHeaders, body)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
+
+// sendNTLM runs the NTLM handshake with the server. NTLM authenticates the
+// connection rather than the request, so every message has to use the one
+// the handshake started on.
+func (c *Client) sendNTLM(t *transport, rawUrl, method string, headers requestHeaders, body []byte) (*Response, error) {
+	var resp *Response
+	err := ntlmAuthenticate(c.username, c.password, func(authorization string) ([]string, error) {
+		hopHeaders := headers.clone()
+		hopHeaders.normal.Set("Authorization", authorization)
+		var err error
+		resp, err = c.roundTrip(t, rawUrl, method, hopHeaders, body)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			return nil, err
+		}
+		return resp.wwwAuthenticate, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if t.conns > 1 {
+		return nil, ErrNTLMConnection
+	}
+	return resp, nil
+}
@@ -0,0 +1,93 @@
+package src
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// CertificateChain is the certificate chain a server presented, with the
+// outcome of verifying it.
+type CertificateChain struct {
+	Address      string // host:port that was connected to
+	TLSVersion   uint16
+	CipherSuite  uint16
+	Certificates []*x509.Certificate // as sent by the server, leaf first
+	Verified     bool                // false when verification is skipped
+	VerifyError  error               // why the chain was rejected, nil if it wasn't
+	PolicyError  error               // why the pinned key or OCSP check failed, even when not Verified
+}
+
+// CertificateChain connects to the server of rawUrl with the TLS settings,
+// proxies and connection settings of requests, and returns the certificates
+// it presents. A chain that fails verification is returned with VerifyError
+// or PolicyError set, only connection failures are errors.
+func (c *Client) CertificateChain(rawUrl string) (*CertificateChain, error) {
+	target, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme != "https" {
+		return nil, fmt.Errorf("%s isn't an https:// url", rawUrl)
+	}
+	addr := target.Host
+	if target.Port() == "" {
+		addr = net.JoinHostPort(target.Hostname(), "443")
+	}
+
+	proxies, err := c.selectProxies(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	for i, proxyURL := range proxies {
+		chain, err := c.certificateChainVia(proxyURL, target.Hostname(), addr)
+		var unreachable *proxyConnectError
+		if i == len(proxies)-1 || !errors.As(err, &unreachable) {
+			return chain, err
+		}
+		c.infof("%v, trying the next one", err)
+	}
+	return nil, errNoRoute
+}
+
+func (c *Client) certificateChainVia(proxyURL *url.URL, host, addr string) (*CertificateChain, error) {
+	cfg, err := c.originTLSConfig(host)
+	if err != nil {
+		return nil, err
+	}
+	chain := &CertificateChain{Address: addr, Verified: !c.originTLS.insecure}
+	// Record the verification result instead of aborting the handshake
+	verify := cfg.VerifyConnection
+	cfg.VerifyConnection = func(state tls.ConnectionState) error {
+		err := verify(state)
+		var policy *policyError
+		if errors.As(err, &policy) {
+			chain.PolicyError = policy.err
+		} else {
+			chain.VerifyError = err
+		}
+		return nil
+	}
+
+	conn, err := c.dialOrigin(proxyURL, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if c.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, fmt.Errorf("TLS handshake with %s: %w", addr, err)
+	}
+	state := tlsConn.ConnectionState()
+	chain.TLSVersion = state.Version
+	chain.CipherSuite = state.CipherSuite
+	chain.Certificates = state.PeerCertificates
+	return chain, nil
+}
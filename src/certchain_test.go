@@ -0,0 +1,69 @@
+package src
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCertificateChain(t *testing.T) {
+	ca, caFile, _ := writeTestCertificate(t, "Test CA")
+	serverCert := issueTestCertificate(t, ca, "server", 42)
+	serverCert.Certificate = append(serverCert.Certificate, ca.Certificate[0])
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}}
+	server.StartTLS()
+	defer server.Close()
+	proxy := authProxy(t)
+	defer proxy.Close()
+
+	for name, c := range map[string]*Client{
+		"direct":      NewClient().SetCACert(caFile),
+		"tunneled":    NewClient().SetCACert(caFile).SetProxy("http://user:pass@" + proxy.Addr().String()),
+		"unknown CA":  NewClient(),
+		"insecure":    NewClient().SetInsecure(true),
+		"wrong pin":   NewClient().SetInsecure(true).SetPinnedPubKey("sha256//AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="),
+		"wrong proxy": NewClient().SetCACert(caFile).SetProxy("http://127.0.0.1:1"),
+	} {
+		chain, err := c.CertificateChain(server.URL)
+		if name == "wrong proxy" {
+			if err == nil {
+				t.Errorf("%s: expected a connection error", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if len(chain.Certificates) != 2 || chain.Certificates[0].Subject.CommonName != "server" {
+			t.Errorf("%s: unexpected chain %v", name, chain.Certificates)
+		}
+		var certErr *CertificateError
+		switch name {
+		case "unknown CA":
+			if !chain.Verified || !errors.As(chain.VerifyError, &certErr) {
+				t.Errorf("%s: expected a CertificateError, got %v", name, chain.VerifyError)
+			}
+		case "insecure":
+			if chain.Verified || chain.VerifyError != nil || chain.PolicyError != nil {
+				t.Errorf("%s: verification should be skipped, got %v, %v", name, chain.VerifyError, chain.PolicyError)
+			}
+		case "wrong pin":
+			// Pinning is checked even when the chain isn't
+			if chain.VerifyError != nil || !errors.Is(chain.PolicyError, ErrPinnedPubKey) {
+				t.Errorf("%s: expected ErrPinnedPubKey apart from the chain, got %v, %v", name, chain.VerifyError, chain.PolicyError)
+			}
+		default:
+			if !chain.Verified || chain.VerifyError != nil {
+				t.Errorf("%s: chain should be valid, got %v", name, chain.VerifyError)
+			}
+		}
+	}
+
+	if _, err := NewClient().CertificateChain("http://example.com"); err == nil {
+		t.Error("http:// urls have no certificates")
+	}
+}
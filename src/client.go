@@ -6,7 +6,6 @@ import (
 	"compress/gzip"
 	"compress/zlib"
 	"context"
-	"crypto/md5"
 	"crypto/tls"
 	"encoding/base64"
 	"errors"
@@ -23,9 +22,9 @@ import (
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
 	"github.com/valyala/fasthttp"
-	"github.com/valyala/fasthttp/fasthttpproxy"
 	"golang.org/x/net/http2"
 )
 
@@ -45,26 +44,61 @@ var (
 )
 
 type Client struct {
-	proxy          string // set to all requests
+	proxy          string  // set to all requests
+	proxyTunnel    bool    // use CONNECT for http:// urls too
+	noProxy        *string // hosts that bypass the proxy, NO_PROXY when nil
+	proxyPAC       string  // PAC file or url, used when proxy is not set
+	pac            *pacScript
 	timeout        time.Duration
 	connectTimeout time.Duration // connection timeout separate from request timeout
-	crt            *tls.Certificate
 	opts           *requestOptions
-	httpVersion    string // "1.0", "1.1", "2", "3"
-	insecure       bool   // allow insecure SSL
+	httpVersion    string     // "1.0", "1.1", "2", "3"
+	priorKnowledge bool       // h2c without the HTTP/1.1 Upgrade
+	http09         bool       // accept HTTP/0.9 responses, which have no headers
+	http3Only      bool       // no fallback to TCP when QUIC gets no answer
+	originTLS      tlsOptions // TLS to the origin server
+	ech            string     // ECHConfigList file, base64 or "auto"
+	// Name resolution and connection fields
+	unixSocket      string        // connect to this Unix socket, "@name" for abstract ones
+	sock            socketOptions // source address and socket options
+	dnsServers      string        // ip[:port] list of DNS servers used instead of the system resolver
+	dohURL          string        // DNS-over-HTTPS server used instead of the system resolver
+	dohInsecure     bool          // skip verifying the DoH server certificate
+	ipVersion       string        // "4" or "6" to resolve names to one address family only
+	resolve         []string      // --resolve entries, host:port:addr[,addr]
+	connectTo       []string      // --connect-to entries, HOST1:PORT1:HOST2:PORT2
+	eyeballsTimeout time.Duration // head start of each address before the next one, RFC 8305
+	altSvc          *altSvcCache  // HTTP/3 alternatives of --alt-svc, nil without it
 	// Authentication fields
 	authType string // "basic", "digest", "ntlm", "negotiate"
 	username string
 	password string
+	digest   *digestSession // last digest challenge, reused until it gets stale
+	// Proxy authentication fields
+	proxyAuthType string // "basic", "digest", "ntlm", "any"
+	proxyUsername string
+	proxyPassword string
+	proxyDigest   *digestSession
+	proxyTLS      tlsOptions // TLS to https:// proxies, separate from the origin's
+	// Redirect fields
+	followRedirects bool
+	maxRedirects    int          // -1 means unlimited
+	postRedirects   map[int]bool // redirect codes that keep POST, see --post301/--post302/--post303
+	locationTrusted bool         // send credentials to other hosts on redirect
+	redirProtocols  []string     // schemes allowed on redirect
+	// verbose receives "* " prefixed lines about what happens on the wire
+	verbose io.Writer
 }
 
 func NewClientPool() sync.Pool {
 	return sync.Pool{
 		New: func() interface{} {
 			return &Client{
-				timeout: defaultTimeDuration,
-				crt:     nil,
-				opts:    newRequestOptions(),
+				timeout:        defaultTimeDuration,
+				opts:           newRequestOptions(),
+				maxRedirects:   defaultMaxRedirects,
+				postRedirects:  make(map[int]bool),
+				redirProtocols: defaultRedirectProtocols,
 			}
 		},
 	}
@@ -72,11 +106,12 @@ func NewClientPool() sync.Pool {
 
 func NewClient() *Client {
 	return &Client{
-		timeout:     defaultTimeDuration,
-		crt:         nil,
-		opts:        newRequestOptions(),
-		httpVersion: "1.1", // default to HTTP/1.1
-		insecure:    false,
+		timeout:        defaultTimeDuration,
+		opts:           newRequestOptions(),
+		httpVersion:    "1.1", // default to HTTP/1.1
+		maxRedirects:   defaultMaxRedirects,
+		postRedirects:  make(map[int]bool),
+		redirProtocols: defaultRedirectProtocols,
 	}
 }
 
@@ -85,6 +120,104 @@ func (c *Client) SetProxy(proxy string) *Client {
 	return c
 }
 
+// SetNoProxy sets the comma separated list of hosts that are reached
+// without a proxy, overriding the NO_PROXY environment variable
+func (c *Client) SetNoProxy(list string) *Client {
+	c.noProxy = &list
+	return c
+}
+
+// SetProxyPAC picks proxies with the FindProxyForURL function of the PAC
+// file at location, a path or a file://, http:// or https:// url
+func (c *Client) SetProxyPAC(location string) *Client {
+	c.proxyPAC = location
+	c.pac = &pacScript{location: location}
+	return c
+}
+
+// SetVerbose makes the client describe connections and proxy choices on w
+func (c *Client) SetVerbose(w io.Writer) *Client {
+	c.verbose = w
+	return c
+}
+
+// infof writes a verbose line, if verbose output is enabled.
+func (c *Client) infof(format string, args ...interface{}) {
+	if c.verbose != nil {
+		fmt.Fprintf(c.verbose, "* "+format+"\n", args...)
+	}
+}
+
+// SetProxyInsecure skips the certificate verification of https:// proxies
+func (c *Client) SetProxyInsecure(insecure bool) *Client {
+	c.proxyTLS.insecure = insecure
+	return c
+}
+
+// SetProxyCACert verifies https:// proxies against the CA bundle in file
+func (c *Client) SetProxyCACert(file string) *Client {
+	c.proxyTLS.caFile = file
+	return c
+}
+
+// SetProxyCAPath verifies https:// proxies against the certificates in dir
+func (c *Client) SetProxyCAPath(dir string) *Client {
+	c.proxyTLS.caPath = dir
+	return c
+}
+
+// SetProxyCRLFile rejects https:// proxies whose certificate is revoked by
+// the CRLs in file
+func (c *Client) SetProxyCRLFile(file string) *Client {
+	c.proxyTLS.crlFile = file
+	return c
+}
+
+// SetProxyCert sets the client certificate for https:// proxies, keyFile
+// may be empty when the key is in certFile
+func (c *Client) SetProxyCert(certFile, keyFile string) *Client {
+	c.proxyTLS.cert.certFile = certFile
+	c.proxyTLS.cert.keyFile = keyFile
+	return c
+}
+
+// SetProxyCertTypes sets the file types of the proxy client certificate
+// ("PEM", "DER" or "P12") and key ("PEM" or "DER")
+func (c *Client) SetProxyCertTypes(certType, keyType string) *Client {
+	c.proxyTLS.cert.certType = certType
+	c.proxyTLS.cert.keyType = keyType
+	return c
+}
+
+// SetProxyKeyPassword sets the password of an encrypted proxy client key or
+// PKCS#12 bundle
+func (c *Client) SetProxyKeyPassword(password string) *Client {
+	c.proxyTLS.cert.password = password
+	return c
+}
+
+// SetProxyPinnedPubKey pins the public key of https:// proxies, given as a
+// key file or sha256//<base64> hashes separated by ';'
+func (c *Client) SetProxyPinnedPubKey(pinnedPubKey string) *Client {
+	c.proxyTLS.pinnedPubKey = pinnedPubKey
+	return c
+}
+
+// SetProxyTLSVersion bounds the TLS versions used with https:// proxies,
+// 0 leaves a bound at the default
+func (c *Client) SetProxyTLSVersion(min, max uint16) *Client {
+	c.proxyTLS.minVersion = min
+	c.proxyTLS.maxVersion = max
+	return c
+}
+
+// SetProxyTunnel makes plain http:// requests go through a CONNECT tunnel
+// instead of being forwarded to the HTTP proxy
+func (c *Client) SetProxyTunnel(tunnel bool) *Client {
+	c.proxyTunnel = tunnel
+	return c
+}
+
 func (c *Client) SetTimeout(duration time.Duration) *Client {
 	c.timeout = duration
 	return c
@@ -100,18 +233,293 @@ func (c *Client) SetHTTPVersion(version string) *Client {
 	return c
 }
 
+// SetHTTP2PriorKnowledge sends HTTP/2 to http:// urls right away, instead of
+// asking for an Upgrade from HTTP/1.1 first
+func (c *Client) SetHTTP2PriorKnowledge(enabled bool) *Client {
+	c.priorKnowledge = enabled
+	if enabled {
+		c.httpVersion = "2"
+	}
+	return c
+}
+
+// SetHTTP3Only uses HTTP/3 without falling back to TCP when QUIC gets no
+// answer, which SetHTTPVersion("3") does
+func (c *Client) SetHTTP3Only(only bool) *Client {
+	c.http3Only = only
+	if only {
+		c.httpVersion = "3"
+	}
+	return c
+}
+
+// SetAltSvc keeps the Alt-Svc headers of https:// origins in the cache file
+// at path, and tries HTTP/3 with the origins that offer it
+func (c *Client) SetAltSvc(path string) *Client {
+	c.altSvc = nil
+	if path != "" {
+		c.altSvc = &altSvcCache{path: path}
+	}
+	return c
+}
+
+// SetHTTP09Allowed accepts HTTP/0.9 responses, a body without status line
+// or headers, from http:// servers
+func (c *Client) SetHTTP09Allowed(allowed bool) *Client {
+	c.http09 = allowed
+	return c
+}
+
 func (c *Client) SetInsecure(insecure bool) *Client {
-	c.insecure = insecure
+	c.originTLS.insecure = insecure
+	return c
+}
+
+// SetTLSVersion bounds the TLS versions used with servers, 0 leaves a bound
+// at the default
+func (c *Client) SetTLSVersion(min, max uint16) *Client {
+	c.originTLS.minVersion = min
+	c.originTLS.maxVersion = max
+	return c
+}
+
+// SetCiphers sets the TLS 1.2 and below cipher suites, as OpenSSL or IANA
+// names separated by ':'
+func (c *Client) SetCiphers(ciphers string) *Client {
+	c.originTLS.ciphers = ciphers
+	return c
+}
+
+// SetTLS13Ciphers sets the TLS 1.3 cipher suites. Go always offers all of
+// them, so a list that leaves one out fails the request
+func (c *Client) SetTLS13Ciphers(ciphers string) *Client {
+	c.originTLS.tls13Ciphers = ciphers
 	return c
 }
 
+// SetCurves sets the key exchange groups, e.g. "X25519:P-256"
+func (c *Client) SetCurves(curves string) *Client {
+	c.originTLS.curves = curves
+	return c
+}
+
+// SetNoALPN stops offering ALPN, which only HTTP/1.x can do without
+func (c *Client) SetNoALPN(noALPN bool) *Client {
+	c.originTLS.noALPN = noALPN
+	return c
+}
+
+// SetPinnedPubKey pins the public key of servers, given as a PEM or DER key
+// file or sha256//<base64> hashes separated by ';'. Connections to a server
+// with another key fail with ErrPinnedPubKey
+func (c *Client) SetPinnedPubKey(pinnedPubKey string) *Client {
+	c.originTLS.pinnedPubKey = pinnedPubKey
+	return c
+}
+
+// SetCertStatus requires servers to staple a good, current OCSP response
+// for their certificate
+func (c *Client) SetCertStatus(certStatus bool) *Client {
+	c.originTLS.certStatus = certStatus
+	return c
+}
+
+// SetKeyLogFile appends the TLS secrets of every connection, to servers and
+// proxies, to file in the NSS key log format. $SSLKEYLOGFILE is used when
+// it isn't set
+func (c *Client) SetKeyLogFile(file string) *Client {
+	c.originTLS.keyLogFile = file
+	c.proxyTLS.keyLogFile = file
+	return c
+}
+
+// SetCACert verifies servers against the PEM bundle in file instead of the
+// system roots
+func (c *Client) SetCACert(file string) *Client {
+	c.originTLS.caFile = file
+	return c
+}
+
+// SetCAPath verifies servers against the PEM certificates in dir instead of
+// the system roots
+func (c *Client) SetCAPath(dir string) *Client {
+	c.originTLS.caPath = dir
+	return c
+}
+
+// SetCRLFile rejects servers whose certificate, or one of its issuers, is
+// revoked by the PEM or DER CRLs in file
+func (c *Client) SetCRLFile(file string) *Client {
+	c.originTLS.crlFile = file
+	return c
+}
+
+// SetECH encrypts the ClientHello to servers with the ECHConfigList in
+// spec, a file or a base64 string, or with the one of their HTTPS DNS
+// record when spec is "auto"
+func (c *Client) SetECH(spec string) *Client {
+	c.ech = spec
+	return c
+}
+
+// SetDNSServers resolves host names with the DNS servers of the comma
+// separated ip[:port] list instead of the system resolver
+func (c *Client) SetDNSServers(list string) *Client {
+	c.dnsServers = list
+	return c
+}
+
+// SetDoHURL resolves host names with the DNS-over-HTTPS server at rawUrl
+// instead of the system resolver, over HTTP/2
+func (c *Client) SetDoHURL(rawUrl string) *Client {
+	c.dohURL = rawUrl
+	return c
+}
+
+// SetDoHInsecure skips verifying the certificate of the DoH server
+func (c *Client) SetDoHInsecure(insecure bool) *Client {
+	c.dohInsecure = insecure
+	return c
+}
+
+// SetIPVersion resolves host names to IPv4 addresses only with "4", IPv6
+// addresses only with "6", or both with ""
+func (c *Client) SetIPVersion(version string) *Client {
+	c.ipVersion = version
+	return c
+}
+
+// SetHappyEyeballsTimeout sets how long a connection attempt to one address
+// of a host runs before the next address, of the other family first, is
+// tried alongside it. It is 200ms when not set
+func (c *Client) SetHappyEyeballsTimeout(timeout time.Duration) *Client {
+	c.eyeballsTimeout = timeout
+	return c
+}
+
+// SetUnixSocket sends every request over the Unix socket at path, without
+// proxies. The url still gives the Host header and the scheme
+func (c *Client) SetUnixSocket(path string) *Client {
+	c.unixSocket = path
+	return c
+}
+
+// SetAbstractUnixSocket sends every request over the Linux abstract Unix
+// socket name, like SetUnixSocket
+func (c *Client) SetAbstractUnixSocket(name string) *Client {
+	c.unixSocket = "@" + name
+	return c
+}
+
+// SetInterface connects from the network interface name, or from the IP
+// address or host name iface
+func (c *Client) SetInterface(iface string) *Client {
+	c.sock.iface = iface
+	return c
+}
+
+// SetLocalPort connects from the source port ports, or from the first free
+// port of a "port-port" range
+func (c *Client) SetLocalPort(ports string) *Client {
+	c.sock.localPort = ports
+	return c
+}
+
+// SetTCPNoDelay turns Nagle's algorithm off, which is the default, or on
+func (c *Client) SetTCPNoDelay(noDelay bool) *Client {
+	c.sock.tcpDelay = !noDelay
+	return c
+}
+
+// SetKeepAliveTime sets the idle time before TCP keepalive probes and the
+// interval between them
+func (c *Client) SetKeepAliveTime(idle time.Duration) *Client {
+	c.sock.keepAlive = idle
+	return c
+}
+
+// SetNoKeepAlive turns TCP keepalive probes off
+func (c *Client) SetNoKeepAlive(noKeepAlive bool) *Client {
+	c.sock.noKeepAlive = noKeepAlive
+	return c
+}
+
+// SetTCPFastOpen sends the first data with the SYN to servers that gave out
+// a Fast Open cookie before. It is only supported on Linux
+func (c *Client) SetTCPFastOpen(fastOpen bool) *Client {
+	c.sock.fastOpen = fastOpen
+	return c
+}
+
+// SetResolve connects to the given addresses instead of resolving host
+// names, with host:port:addr[,addr] entries. The url keeps the name, so the
+// Host header and SNI are unchanged
+func (c *Client) SetResolve(entries []string) *Client {
+	c.resolve = entries
+	return c
+}
+
+// SetConnectTo connects to HOST2:PORT2 for requests to HOST1:PORT1, with
+// HOST1:PORT1:HOST2:PORT2 entries where empty fields match any host or
+// port, or keep it. The Host header and SNI are unchanged
+func (c *Client) SetConnectTo(entries []string) *Client {
+	c.connectTo = entries
+	return c
+}
+
+// SetFollowRedirects makes the client follow 3xx responses
+func (c *Client) SetFollowRedirects(follow bool) *Client {
+	c.followRedirects = follow
+	return c
+}
+
+// SetMaxRedirects limits the number of followed redirects, -1 means unlimited
+func (c *Client) SetMaxRedirects(max int) *Client {
+	c.maxRedirects = max
+	return c
+}
+
+// SetPostRedirects keeps POST instead of switching to GET after a 301, 302 or 303
+func (c *Client) SetPostRedirects(post301, post302, post303 bool) *Client {
+	c.postRedirects[http.StatusMovedPermanently] = post301
+	c.postRedirects[http.StatusFound] = post302
+	c.postRedirects[http.StatusSeeOther] = post303
+	return c
+}
+
+// SetLocationTrusted sends credentials to other hosts when following redirects
+func (c *Client) SetLocationTrusted(trusted bool) *Client {
+	c.locationTrusted = trusted
+	return c
+}
+
+// SetRedirectProtocols sets the url schemes a redirect is allowed to switch to
+func (c *Client) SetRedirectProtocols(protocols []string) *Client {
+	c.redirProtocols = protocols
+	return c
+}
+
+// SetCrt sets the client certificate, keyPath may be empty when the key is
+// in certPath. The files are loaded by the request, which fails if they
+// can't be used.
 func (c *Client) SetCrt(certPath, keyPath string) *Client {
-	clientCrt, err := tls.LoadX509KeyPair(certPath, keyPath)
-	if err != nil {
-		// todo handle this err
-		clientCrt = tls.Certificate{}
-	}
-	c.crt = &clientCrt
+	c.originTLS.cert.certFile = certPath
+	c.originTLS.cert.keyFile = keyPath
+	return c
+}
+
+// SetCertTypes sets the file types of the client certificate ("PEM", "DER"
+// or "P12") and key ("PEM" or "DER")
+func (c *Client) SetCertTypes(certType, keyType string) *Client {
+	c.originTLS.cert.certType = certType
+	c.originTLS.cert.keyType = keyType
+	return c
+}
+
+// SetKeyPassword sets the password of an encrypted client key or PKCS#12
+// bundle
+func (c *Client) SetKeyPassword(password string) *Client {
+	c.originTLS.cert.password = password
 	return c
 }
 
@@ -148,6 +556,36 @@ func (c *Client) SetNTLMAuth(userPass string) *Client {
 	return c
 }
 
+// SetProxyBasicAuth configures Basic Authentication on the proxy
+func (c *Client) SetProxyBasicAuth(userPass string) *Client {
+	return c.setProxyAuth("basic", userPass)
+}
+
+// SetProxyDigestAuth configures Digest Authentication on the proxy
+func (c *Client) SetProxyDigestAuth(userPass string) *Client {
+	return c.setProxyAuth("digest", userPass)
+}
+
+// SetProxyNTLMAuth configures NTLM Authentication on the proxy
+func (c *Client) SetProxyNTLMAuth(userPass string) *Client {
+	return c.setProxyAuth("ntlm", userPass)
+}
+
+// SetProxyAnyAuth picks the strongest scheme the proxy offers
+func (c *Client) SetProxyAnyAuth(userPass string) *Client {
+	return c.setProxyAuth("any", userPass)
+}
+
+func (c *Client) setProxyAuth(authType, userPass string) *Client {
+	parts := strings.SplitN(userPass, ":", 2)
+	if len(parts) == 2 {
+		c.proxyAuthType = authType
+		c.proxyUsername = parts[0]
+		c.proxyPassword = parts[1]
+	}
+	return c
+}
+
 // SetNegotiateAuth configures HTTP Negotiate (SPNEGO) Authentication
 func (c *Client) SetNegotiateAuth(userPass string) *Client {
 	parts := strings.SplitN(userPass, ":", 2)
@@ -160,63 +598,27 @@ func (c *Client) SetNegotiateAuth(userPass string) *Client {
 }
 
 // addAuthenticationHeaders adds authentication headers based on the configured auth type
-func (c *Client) addAuthenticationHeaders(headers requestHeaders) {
+func (c *Client) addAuthenticationHeaders(headers requestHeaders, method, rawUrl string, body []byte) {
 	switch c.authType {
 	case "basic":
 		auth := base64.StdEncoding.EncodeToString([]byte(c.username + ":" + c.password))
 		headers.normal.Set("Authorization", "Basic "+auth)
 	case "digest":
-		// For digest auth, we need to handle the initial request and response challenge
-		// This is a simplified implementation - in practice, digest auth requires
-		// parsing the WWW-Authenticate header from a 401 response
-		headers.normal.Set("Authorization", "Digest username=\""+c.username+"\"")
+		// Digest needs a challenge from the server first, see Client.send
+		if c.digest != nil {
+			auth, err := c.digest.authorization(c.username, c.password, method, requestTarget(rawUrl), body)
+			if err == nil {
+				headers.normal.Set("Authorization", auth)
+			}
+		}
 	case "ntlm":
-		// NTLM requires a complex handshake - this is a placeholder
-		headers.normal.Set("Authorization", "NTLM")
+		// NTLM authenticates the connection, see Client.sendNTLM
 	case "negotiate":
 		// Negotiate (SPNEGO) requires GSSAPI/Kerberos - this is a placeholder
 		headers.normal.Set("Authorization", "Negotiate")
 	}
 }
 
-// parseDigestChallenge parses a digest challenge and returns authentication header
-func (c *Client) parseDigestChallenge(challenge, method, uri string) string {
-	// Parse the challenge parameters
-	params := make(map[string]string)
-
-	// Simple parsing - in production this should be more robust
-	parts := strings.Split(challenge, ",")
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		if idx := strings.Index(part, "="); idx > 0 {
-			key := strings.TrimSpace(part[:idx])
-			value := strings.Trim(strings.TrimSpace(part[idx+1:]), "\"")
-			params[key] = value
-		}
-	}
-
-	realm := params["realm"]
-	nonce := params["nonce"]
-	qop := params["qop"]
-
-	// Generate response hash
-	ha1 := fmt.Sprintf("%x", md5.Sum([]byte(c.username+":"+realm+":"+c.password)))
-	ha2 := fmt.Sprintf("%x", md5.Sum([]byte(method+":"+uri)))
-
-	var response string
-	if qop == "auth" {
-		nc := "00000001"
-		cnonce := "0a4f113b"
-		response = fmt.Sprintf("%x", md5.Sum([]byte(ha1+":"+nonce+":"+nc+":"+cnonce+":"+qop+":"+ha2)))
-		return fmt.Sprintf("Digest username=\"%s\", realm=\"%s\", nonce=\"%s\", uri=\"%s\", qop=%s, nc=%s, cnonce=\"%s\", response=\"%s\"",
-			c.username, realm, nonce, uri, qop, nc, cnonce, response)
-	} else {
-		response = fmt.Sprintf("%x", md5.Sum([]byte(ha1+":"+nonce+":"+ha2)))
-		return fmt.Sprintf("Digest username=\"%s\", realm=\"%s\", nonce=\"%s\", uri=\"%s\", response=\"%s\"",
-			c.username, realm, nonce, uri, response)
-	}
-}
-
 func (c *Client) AddParam(key, value string) *Client {
 	c.opts.params.Set(key, value)
 	return c
@@ -424,17 +826,271 @@ func (c *Client) SendFile(url string) (*Response, error) {
 	return c.call(url, fasthttp.MethodPost, c.opts.headers, bodyBuffer.Bytes())
 }
 
-func (c *Client) call(url, method string, headers requestHeaders, body []byte) (*Response, error) {
-	// Use HTTP/2 or HTTP/3 if specified
-	if c.httpVersion == "2" || c.httpVersion == "3" {
-		return c.callHTTP2OrHTTP3(url, method, headers, body)
+// call sends the request and, if enabled, follows the redirect chain.
+func (c *Client) call(rawUrl, method string, headers requestHeaders, body []byte) (*Response, error) {
+	origin, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	var redirects []Redirect
+	trusted := true
+	for {
+		resp, err := c.send(rawUrl, method, headers, body, trusted)
+		if err != nil {
+			return nil, err
+		}
+		resp.Redirects = redirects
+
+		location := resp.Header.Get("Location")
+		if !c.followRedirects || !isRedirect(resp.StatusCode) || location == "" {
+			return resp, nil
+		}
+		if c.maxRedirects >= 0 && len(redirects) >= c.maxRedirects {
+			return nil, fmt.Errorf("%w (%d)", ErrTooManyRedirects, c.maxRedirects)
+		}
+
+		next, err := c.redirectLocation(rawUrl, location)
+		if err != nil {
+			return nil, err
+		}
+		nextMethod, keepBody := c.redirectMethod(resp.StatusCode, method)
+		if !keepBody {
+			body = nil
+			headers = headers.withoutBody()
+		}
+
+		redirects = append(redirects, Redirect{
+			StatusCode: resp.StatusCode,
+			Method:     method,
+			URL:        rawUrl,
+			Location:   next.String(),
+		})
+		trusted = c.locationTrusted || sameOrigin(origin, next)
+		rawUrl, method = next.String(), nextMethod
+	}
+}
+
+// transport sends the requests of one hop over a single client, so that
+// authentication round trips can share a connection.
+type transport struct {
+	fast      *fasthttp.Client
+	std       *http.Client
+	version   string   // HTTP version of the requests, like Client.httpVersion
+	proxy     *url.URL // nil for direct connections
+	forward   bool     // send requests in absolute-form to an HTTP proxy
+	cleartext bool     // HTTP/2 without TLS, h2c
+	upgrade   bool     // send the next request over HTTP/1.1 asking for h2c
+	http09    bool     // accept HTTP/0.9 responses on the plain connections
+	conns     int      // connections opened so far
+
+	// HTTP/3 transports that may fall back to TCP
+	tcp     *transport // where requests go once QUIC got no answer
+	alt     string     // host:port of the Alt-Svc alternative to connect to
+	quicErr error      // why QUIC got no answer
+}
+
+func (c *Client) newTransport(rawUrl string, proxyURL *url.URL) (*transport, error) {
+	target, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	alt := c.altSvcAlternative(target, proxyURL)
+	if c.http3Only {
+		t, err := c.newVersionTransport(target, proxyURL, c.httpVersion)
+		if err != nil {
+			return nil, err
+		}
+		t.alt = alt
+		return t, nil
+	}
+	if alt == "" && c.httpVersion != "3" {
+		return c.newVersionTransport(target, proxyURL, c.httpVersion)
+	}
+
+	// HTTP/3 falls back to TCP with the version chosen for the other
+	// requests, or HTTP/1.1. Only https:// urls can use HTTP/3.
+	tcpVersion := c.httpVersion
+	if tcpVersion == "3" {
+		tcpVersion = "1.1"
+	}
+	if target.Scheme != "https" {
+		return c.newVersionTransport(target, proxyURL, tcpVersion)
+	}
+	t, err := c.newVersionTransport(target, proxyURL, "3")
+	if err != nil {
+		return nil, err
+	}
+	t.alt = alt
+	t.tcp, err = c.newVersionTransport(target, proxyURL, tcpVersion)
+	return t, err
+}
+
+// newVersionTransport returns a transport for the requests of one HTTP
+// version to target.
+func (c *Client) newVersionTransport(target *url.URL, proxyURL *url.URL, version string) (*transport, error) {
+	var err error
+	if target.Scheme == "https" {
+		if err := c.originTLS.checkHTTPVersion(version); err != nil {
+			return nil, err
+		}
+	}
+	if c.unixSocket != "" && version == "3" {
+		return nil, ErrHTTP3UnixSocket
+	}
+	var tlsConfig *tls.Config
+	if target.Scheme == "https" {
+		tlsConfig, err = c.originTLSConfig(target.Hostname())
+	} else {
+		tlsConfig, err = c.originTLS.config(target.Hostname(), c.infof)
+	}
+	if err != nil {
+		return nil, err
+	}
+	t := &transport{
+		version: version,
+		proxy:   proxyURL,
+		forward: proxyURL != nil && !c.proxyTunnel && !isSOCKS(proxyURL.Scheme) &&
+			target.Scheme == "http",
+		// fasthttp adds TLS on top of what Dial returns, so only plain
+		// connections can be read before the status line is parsed
+		http09: c.http09 && target.Scheme == "http",
+	}
+	// Use HTTP/2 or HTTP/3 if specified, fasthttp for HTTP/1.x. Forward
+	// proxies get HTTP/1.1 like curl sends them, and http:// urls start
+	// with an Upgrade to h2c unless the server is known to speak it.
+	if version == "3" || version == "2" && !t.forward {
+		t.cleartext = version == "2" && target.Scheme == "http"
+		t.upgrade = t.cleartext && !c.priorKnowledge
+		t.std = c.newHTTPClient(t, tlsConfig)
+	}
+	if t.std == nil || t.upgrade {
+		// HTTP/2 and HTTP/3 set their own ALPN protocol
+		if !c.originTLS.noALPN {
+			tlsConfig.NextProtos = []string{"http/1.1"}
+			if version == "1.0" {
+				tlsConfig.NextProtos = []string{"http/1.0"}
+			}
+		}
+		t.fast = c.newFastHTTPClient(t, tlsConfig)
+	}
+	return t, nil
+}
+
+// roundTrip sends a single request without following redirects.
+func (c *Client) roundTrip(t *transport, url, method string, headers requestHeaders, body []byte) (*Response, error) {
+	if t.tcp != nil {
+		return c.fallbackRoundTrip(t, url, method, headers, body)
+	}
+	if t.upgrade {
+		return c.upgradeRoundTrip(t, url, method, headers, body)
+	}
+	if t.std != nil {
+		return c.callHTTP2OrHTTP3(t, url, method, headers, body)
+	}
+	if t.forward {
+		return c.forwardRoundTrip(t, url, method, headers, body)
+	}
+	return c.callFastHTTP(t, url, method, headers, body)
+}
+
+// dialTCP opens a direct connection to addr, racing its addresses.
+func (c *Client) dialTCP(addr string) (net.Conn, error) {
+	addrs, err := c.lookupAddrs(addr)
+	if err != nil {
+		return nil, err
 	}
+	return happyEyeballs(c, context.Background(), c.happyEyeballsDelay(), interleaveFamilies(addrs),
+		c.dialContext, func(conn net.Conn) { conn.Close() })
+}
 
-	// Use fasthttp for HTTP/1.x
-	return c.callFastHTTP(url, method, headers, body)
+// dialOrigin connects to the origin server at addr, or where --connect-to
+// sends it, through proxyURL unless it is nil. With a Unix socket, that is
+// where every request goes.
+func (c *Client) dialOrigin(proxyURL *url.URL, addr string) (net.Conn, error) {
+	if c.unixSocket != "" {
+		return c.dialUnix()
+	}
+	addr, err := c.connectTarget(addr)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL != nil {
+		return c.dialProxy(proxyURL, addr)
+	}
+	return c.dialTCP(addr)
 }
 
-func (c *Client) callFastHTTP(url, method string, headers requestHeaders, body []byte) (*Response, error) {
+// dialQUIC is the HTTP/3 dialer of direct connections, which finds the
+// addresses to try like dialOrigin.
+func (c *Client) dialQUIC(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+	addr, err := c.connectTarget(addr)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := c.lookupAddrs(addr)
+	if err != nil {
+		return nil, err
+	}
+	return happyEyeballs(c, ctx, c.happyEyeballsDelay(), interleaveFamilies(addrs),
+		func(ctx context.Context, addr string) (*quic.Conn, error) {
+			udpAddr, err := net.ResolveUDPAddr("udp", addr)
+			if err != nil {
+				return nil, err
+			}
+			pc, err := c.listenPacket(ctx, addr)
+			if err != nil {
+				return nil, err
+			}
+			conn, err := quic.DialEarly(ctx, pc, udpAddr, tlsCfg, cfg)
+			if err != nil {
+				pc.Close()
+				return nil, err
+			}
+			context.AfterFunc(conn.Context(), func() { pc.Close() })
+			return conn, nil
+		},
+		func(conn *quic.Conn) { conn.CloseWithError(0, "") })
+}
+
+// happyEyeballsDelay is the head start of connection attempts.
+func (c *Client) happyEyeballsDelay() time.Duration {
+	if c.eyeballsTimeout > 0 {
+		return c.eyeballsTimeout
+	}
+	return defaultHappyEyeballsTimeout
+}
+
+func (c *Client) newFastHTTPClient(t *transport, tlsConfig *tls.Config) *fasthttp.Client {
+	client := &fasthttp.Client{
+		ReadTimeout: c.timeout,
+		TLSConfig:   tlsConfig,
+		// Keeps the absolute-form request-target of forwarded requests
+		DisablePathNormalizing: t.forward,
+	}
+
+	// Set connect timeout if specified
+	if c.connectTimeout > 0 {
+		client.WriteTimeout = c.connectTimeout
+	}
+	client.Dial = func(addr string) (net.Conn, error) {
+		t.conns++
+		var conn net.Conn
+		var err error
+		if t.forward {
+			conn, err = c.dialProxyServer(t.proxy)
+		} else {
+			conn, err = c.dialOrigin(t.proxy, addr)
+		}
+		if err == nil && t.http09 {
+			conn = &http09Conn{Conn: conn}
+		}
+		return conn, err
+	}
+	return client
+}
+
+func (c *Client) callFastHTTP(t *transport, url, method string, headers requestHeaders, body []byte) (*Response, error) {
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
 	resp := fasthttp.AcquireResponse()
@@ -442,9 +1098,18 @@ func (c *Client) callFastHTTP(url, method string, headers requestHeaders, body [
 
 	req.SetRequestURI(url)
 	req.Header.SetMethod(method)
-
-	// Add authentication headers if configured
-	c.addAuthenticationHeaders(headers)
+	if t.version == "1.0" {
+		// The body is always sent with a Content-Length, HTTP/1.0 has no
+		// chunked uploads
+		req.Header.SetProtocol("HTTP/1.0")
+		req.SetConnectionClose()
+	}
+	if t.forward {
+		// fasthttp writes the path as request-target, make it the
+		// absolute url a forward proxy expects.
+		uri := req.URI()
+		uri.SetPath(string(uri.Scheme()) + "://" + string(uri.Host()) + string(uri.PathOriginal()))
+	}
 
 	// Handle cookies by creating a proper Cookie header
 	if len(headers.cookies.Mapper) > 0 {
@@ -502,43 +1167,7 @@ func (c *Client) callFastHTTP(url, method string, headers requestHeaders, body [
 		}
 	}
 
-	client := &fasthttp.Client{
-		ReadTimeout: c.timeout,
-	}
-
-	// Set connect timeout if specified
-	if c.connectTimeout > 0 {
-		client.WriteTimeout = c.connectTimeout
-		client.ReadTimeout = c.timeout
-		// Create a custom dialer with connect timeout
-		if c.proxy != "" {
-			// Use proxy dialer with connect timeout
-			client.Dial = func(addr string) (net.Conn, error) {
-				proxyDialer := fasthttpproxy.FasthttpHTTPDialer(c.proxy)
-				return proxyDialer(addr)
-			}
-		} else {
-			// Use direct dialer with connect timeout
-			client.Dial = func(addr string) (net.Conn, error) {
-				return net.DialTimeout("tcp", addr, c.connectTimeout)
-			}
-		}
-	} else if c.proxy != "" {
-		client.Dial = fasthttpproxy.FasthttpHTTPDialer(c.proxy)
-	}
-
-	if c.crt != nil {
-		client.TLSConfig = &tls.Config{
-			InsecureSkipVerify: c.insecure,
-			Certificates:       []tls.Certificate{*c.crt},
-		}
-	} else if c.insecure {
-		client.TLSConfig = &tls.Config{
-			InsecureSkipVerify: true,
-		}
-	}
-
-	if err := client.Do(req, resp); err != nil {
+	if err := t.fast.Do(req, resp); err != nil {
 		return nil, err
 	}
 
@@ -556,6 +1185,7 @@ func (c *Client) callFastHTTP(url, method string, headers requestHeaders, body [
 		Cookie:     RequestCookies{Mapper: NewCookies()},
 		Header:     RequestHeaders{Mapper: NewHeaders()},
 		StatusCode: resp.StatusCode(),
+		Proto:      string(resp.Header.Protocol()),
 		Body:       responseBody,
 	}
 	resp.Header.VisitAll(func(key, value []byte) {
@@ -564,6 +1194,13 @@ func (c *Client) callFastHTTP(url, method string, headers requestHeaders, body [
 		if strings.ToLower(string(key)) == "set-cookie" {
 			parseCookieFromSetCookie(string(value), ret.Cookie)
 		}
+		// Keep every challenge, a server may send one header per algorithm
+		if strings.ToLower(string(key)) == "www-authenticate" {
+			ret.wwwAuthenticate = append(ret.wwwAuthenticate, string(value))
+		}
+		if strings.ToLower(string(key)) == "proxy-authenticate" {
+			ret.proxyAuthenticate = append(ret.proxyAuthenticate, string(value))
+		}
 	})
 	return ret, nil
 }
@@ -582,40 +1219,64 @@ func parseCookieFromSetCookie(setCookieValue string, cookies RequestCookies) {
 	}
 }
 
-func (c *Client) callHTTP2OrHTTP3(url, method string, headers requestHeaders, body []byte) (*Response, error) {
+func (c *Client) newHTTPClient(t *transport, tlsConfig *tls.Config) *http.Client {
 	var client *http.Client
 
-	if c.httpVersion == "3" {
+	if t.version == "3" {
 		// HTTP/3 client
+		transport := &http3.Transport{
+			TLSClientConfig: tlsConfig,
+		}
+		if c.connectTimeout > 0 {
+			transport.QUICConfig = &quic.Config{HandshakeIdleTimeout: c.connectTimeout}
+		}
+		dial := c.dialQUIC
+		if t.proxy != nil && isSOCKS(t.proxy.Scheme) {
+			dial = func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+				addr, err := c.connectTarget(addr)
+				if err != nil {
+					return nil, err
+				}
+				return c.dialSOCKSQUIC(ctx, t.proxy, addr, tlsCfg, cfg)
+			}
+		} else if t.proxy != nil {
+			// QUIC needs UDP, which an HTTP proxy can't carry
+			dial = func(context.Context, string, *tls.Config, *quic.Config) (*quic.Conn, error) {
+				return nil, ErrHTTP3Proxy
+			}
+		}
+		transport.Dial = func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+			if t.alt != "" {
+				addr = t.alt
+			}
+			conn, err := dial(ctx, addr, tlsCfg, cfg)
+			if err != nil && quicUnanswered(err) {
+				t.quicErr = err
+			}
+			return conn, err
+		}
 		client = &http.Client{
-			Transport: &http3.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: c.insecure,
-				},
-			},
-			Timeout: c.timeout,
+			Transport: transport,
+			Timeout:   c.timeout,
 		}
 	} else {
 		// HTTP/2 client
-		tlsConfig := &tls.Config{
-			InsecureSkipVerify: c.insecure,
-		}
-		if c.crt != nil {
-			tlsConfig.Certificates = []tls.Certificate{*c.crt}
-		}
-
 		transport := &http2.Transport{
 			TLSClientConfig: tlsConfig,
+			AllowHTTP:       t.cleartext,
 		}
-
-		// Set dial timeout if connectTimeout is specified
-		if c.connectTimeout > 0 {
-			transport.DialTLS = func(network, addr string, cfg *tls.Config) (net.Conn, error) {
-				dialer := &net.Dialer{
-					Timeout: c.connectTimeout,
-				}
-				return tls.DialWithDialer(dialer, network, addr, cfg)
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			t.conns++
+			conn, err := c.dialOrigin(t.proxy, addr)
+			if err != nil || t.cleartext {
+				return conn, err
 			}
+			tlsConn := tls.Client(conn, cfg)
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return tlsConn, nil
 		}
 
 		client = &http.Client{
@@ -623,8 +1284,29 @@ func (c *Client) callHTTP2OrHTTP3(url, method string, headers requestHeaders, bo
 			Timeout:   c.timeout,
 		}
 	}
+	// Redirects are followed by Client.call for every protocol version
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return client
+}
 
-	// Create request
+func (c *Client) callHTTP2OrHTTP3(t *transport, url, method string, headers requestHeaders, body []byte) (*Response, error) {
+	req, err := newStdRequest(url, method, headers, body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make request
+	resp, err := t.std.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return newStdResponse(resp)
+}
+
+// newStdRequest is the net/http request of the HTTP/2 and HTTP/3 transports.
+func newStdRequest(url, method string, headers requestHeaders, body []byte) (*http.Request, error) {
 	var bodyReader io.Reader
 	if body != nil {
 		bodyReader = bytes.NewReader(body)
@@ -635,9 +1317,6 @@ func (c *Client) callHTTP2OrHTTP3(url, method string, headers requestHeaders, bo
 		return nil, err
 	}
 
-	// Add authentication headers if configured
-	c.addAuthenticationHeaders(headers)
-
 	// Set headers
 	for key, value := range headers.normal.Mapper {
 		req.Header.Set(key, value)
@@ -653,12 +1332,11 @@ func (c *Client) callHTTP2OrHTTP3(url, method string, headers requestHeaders, bo
 			req.Header.Set("Cookie", strings.Join(cookiePairs, "; "))
 		}
 	}
+	return req, nil
+}
 
-	// Make request
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
+// newStdResponse reads and closes the body of a net/http response.
+func newStdResponse(resp *http.Response) (*Response, error) {
 	defer resp.Body.Close()
 
 	// Read response body
@@ -681,8 +1359,13 @@ func (c *Client) callHTTP2OrHTTP3(url, method string, headers requestHeaders, bo
 		Cookie:     RequestCookies{Mapper: NewCookies()},
 		Header:     RequestHeaders{Mapper: NewHeaders()},
 		StatusCode: resp.StatusCode,
+		Proto:      resp.Proto,
 		Body:       respBody,
 	}
+	if resp.ProtoMajor >= 2 {
+		// Like curl's status lines, "HTTP/2" and "HTTP/3"
+		ret.Proto = fmt.Sprintf("HTTP/%d", resp.ProtoMajor)
+	}
 
 	// Copy headers
 	for key, values := range resp.Header {
@@ -690,6 +1373,8 @@ func (c *Client) callHTTP2OrHTTP3(url, method string, headers requestHeaders, bo
 			ret.Header.Set(key, values[0])
 		}
 	}
+	ret.wwwAuthenticate = resp.Header.Values("WWW-Authenticate")
+	ret.proxyAuthenticate = resp.Header.Values("Proxy-Authenticate")
 
 	// Copy cookies
 	for _, cookie := range resp.Cookies() {
@@ -701,9 +1386,14 @@ func (c *Client) callHTTP2OrHTTP3(url, method string, headers requestHeaders, bo
 
 type Response struct {
 	StatusCode int
+	Proto      string // protocol of the response, like "HTTP/1.1" or "HTTP/2"
 	Body       []byte
 	Header     RequestHeaders
 	Cookie     RequestCookies
+	Redirects  []Redirect // followed redirects, oldest first
+
+	wwwAuthenticate   []string // all WWW-Authenticate values, Header keeps only one
+	proxyAuthenticate []string // all Proxy-Authenticate values
 }
 
 func addString(ss ...string) string {
@@ -775,3 +1465,18 @@ type requestHeaders struct {
 	normal  RequestHeaders
 	cookies RequestCookies
 }
+
+// clone returns a deep copy so per request changes don't leak into options.
+func (h requestHeaders) clone() requestHeaders {
+	ret := requestHeaders{
+		normal:  RequestHeaders{Mapper: NewHeaders()},
+		cookies: RequestCookies{Mapper: NewCookies()},
+	}
+	for key, value := range h.normal.Mapper {
+		ret.normal.Set(key, value)
+	}
+	for key, value := range h.cookies.Mapper {
+		ret.cookies.Set(key, value)
+	}
+	return ret
+}
@@ -0,0 +1,273 @@
+package src
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/pbkdf2"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var ErrKeyPassword = errors.New("the private key is encrypted, a password is needed")
+
+// clientCert describes where the client certificate and its key come from.
+type clientCert struct {
+	certFile string
+	certType string // "PEM" (default), "DER" or "P12"
+	keyFile  string // may be empty when the key is in certFile
+	keyType  string // "PEM" (default) or "DER"
+	password string // for encrypted PKCS#8 keys and PKCS#12 bundles
+}
+
+// load reads the certificate and key and checks that they belong together.
+func (cc clientCert) load() (tls.Certificate, error) {
+	cert, err := cc.loadCertificate()
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("client certificate %s: %w", cc.certFile, err)
+	}
+	return cert, nil
+}
+
+func (cc clientCert) loadCertificate() (tls.Certificate, error) {
+	data, err := os.ReadFile(cc.certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	var cert tls.Certificate
+	switch strings.ToUpper(cc.certType) {
+	case "P12", "PKCS12":
+		key, leaf, chain, err := pkcs12.DecodeChain(data, cc.password)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		cert.Certificate = append(cert.Certificate, leaf.Raw)
+		for _, ca := range chain {
+			cert.Certificate = append(cert.Certificate, ca.Raw)
+		}
+		cert.PrivateKey = key
+		cert.Leaf = leaf
+		return cert, nil
+	case "DER":
+		cert.Certificate = [][]byte{data}
+	case "", "PEM":
+		var keyBlock *pem.Block
+		for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+			switch {
+			case block.Type == "CERTIFICATE":
+				cert.Certificate = append(cert.Certificate, block.Bytes)
+			case strings.HasSuffix(block.Type, "PRIVATE KEY") && cc.keyFile == "":
+				keyBlock = block
+			}
+		}
+		if len(cert.Certificate) == 0 {
+			return tls.Certificate{}, errors.New("no PEM certificate found")
+		}
+		if keyBlock != nil {
+			if cert.PrivateKey, err = parsePEMKey(keyBlock, cc.password); err != nil {
+				return tls.Certificate{}, err
+			}
+		}
+	default:
+		return tls.Certificate{}, fmt.Errorf("unsupported certificate type %q", cc.certType)
+	}
+
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return tls.Certificate{}, err
+	}
+	if cert.PrivateKey == nil {
+		keyFile := cc.keyFile
+		if keyFile == "" {
+			keyFile = cc.certFile
+		}
+		if cert.PrivateKey, err = cc.loadKey(keyFile); err != nil {
+			return tls.Certificate{}, fmt.Errorf("private key %s: %w", keyFile, err)
+		}
+	}
+
+	type publicKey interface{ Equal(crypto.PublicKey) bool }
+	signer, ok := cert.PrivateKey.(crypto.Signer)
+	if !ok || !signer.Public().(publicKey).Equal(cert.Leaf.PublicKey) {
+		return tls.Certificate{}, errors.New("private key does not match the certificate")
+	}
+	return cert, nil
+}
+
+// loadKey reads a PEM or DER private key.
+func (cc clientCert) loadKey(keyFile string) (crypto.PrivateKey, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToUpper(cc.keyType) {
+	case "DER":
+		return parseDERKey(data, cc.password)
+	case "", "PEM":
+		for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+			if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+				return parsePEMKey(block, cc.password)
+			}
+		}
+		return nil, errors.New("no PEM private key found")
+	}
+	return nil, fmt.Errorf("unsupported key type %q", cc.keyType)
+}
+
+func parsePEMKey(block *pem.Block, password string) (crypto.PrivateKey, error) {
+	if _, ok := block.Headers["DEK-Info"]; ok {
+		return nil, errors.New("legacy encrypted PEM keys are not supported, convert the key to encrypted PKCS#8")
+	}
+	return parseDERKey(block.Bytes, password)
+}
+
+// parseDERKey parses PKCS#8, encrypted PKCS#8, PKCS#1 and SEC 1 keys.
+func parseDERKey(der []byte, password string) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	var encrypted encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &encrypted); err != nil || len(rest) > 0 {
+		return nil, errors.New("unknown private key format")
+	}
+	if password == "" {
+		return nil, ErrKeyPassword
+	}
+	plain, err := decryptPBES2(encrypted, password)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(plain)
+	if err != nil {
+		return nil, errors.New("wrong password for the private key")
+	}
+	switch key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported private key type %T", key)
+}
+
+// RFC 8018 structures of encrypted PKCS#8 keys.
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	pbkdf2PRFs = map[string]func() hash.Hash{
+		"1.2.840.113549.2.7":  sha1.New,
+		"1.2.840.113549.2.9":  sha256.New,
+		"1.2.840.113549.2.10": sha512.New384,
+		"1.2.840.113549.2.11": sha512.New,
+	}
+
+	pbes2Ciphers = map[string]struct {
+		keyLength int
+		block     func([]byte) (cipher.Block, error)
+	}{
+		"2.16.840.1.101.3.4.1.2":  {16, aes.NewCipher},
+		"2.16.840.1.101.3.4.1.22": {24, aes.NewCipher},
+		"2.16.840.1.101.3.4.1.42": {32, aes.NewCipher},
+		"1.2.840.113549.3.7":      {24, des.NewTripleDESCipher},
+	}
+)
+
+// decryptPBES2 decrypts a PKCS#8 key protected with PBES2, PBKDF2 and a CBC
+// cipher, which is what OpenSSL writes by default.
+func decryptPBES2(info encryptedPrivateKeyInfo, password string) ([]byte, error) {
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported key encryption %s, only PBES2 is supported", info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation %s", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, err
+	}
+	prf := sha1.New
+	if len(kdf.PRF.Algorithm) > 0 {
+		var ok bool
+		if prf, ok = pbkdf2PRFs[kdf.PRF.Algorithm.String()]; !ok {
+			return nil, fmt.Errorf("unsupported PBKDF2 function %s", kdf.PRF.Algorithm)
+		}
+	}
+	scheme, ok := pbes2Ciphers[params.EncryptionScheme.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported key cipher %s", params.EncryptionScheme.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+
+	key, err := pbkdf2.Key(prf, password, kdf.Salt, kdf.IterationCount, scheme.keyLength)
+	if err != nil {
+		return nil, err
+	}
+	block, err := scheme.block(key)
+	if err != nil {
+		return nil, err
+	}
+	data := info.EncryptedData
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, errors.New("malformed encrypted private key")
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	// PKCS#7 padding, a wrong password usually shows up here
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, errors.New("wrong password for the private key")
+	}
+	for _, b := range plain[len(plain)-padding:] {
+		if int(b) != padding {
+			return nil, errors.New("wrong password for the private key")
+		}
+	}
+	return plain[:len(plain)-padding], nil
+}
@@ -0,0 +1,162 @@
+package src
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// encryptPKCS8 protects a PKCS#8 key the way OpenSSL does by default, with
+// PBES2, PBKDF2-HMAC-SHA256 and AES-256-CBC.
+func encryptPKCS8(t *testing.T, der []byte, password string) []byte {
+	t.Helper()
+	salt, iv := make([]byte, 16), make([]byte, aes.BlockSize)
+	rand.Read(salt)
+	rand.Read(iv)
+	key, err := pbkdf2.Key(sha256.New, password, salt, 2048, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padding := aes.BlockSize - len(der)%aes.BlockSize
+	for i := 0; i < padding; i++ {
+		der = append(der, byte(padding))
+	}
+	block, _ := aes.NewCipher(key)
+	encrypted := make([]byte, len(der))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, der)
+
+	kdf, _ := asn1.Marshal(pbkdf2Params{Salt: salt, IterationCount: 2048,
+		PRF: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}, Parameters: asn1.NullRawValue}})
+	ivDER, _ := asn1.Marshal(iv)
+	params, _ := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdf}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}, Parameters: asn1.RawValue{FullBytes: ivDER}},
+	})
+	info, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: encrypted,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func TestLoadClientCert(t *testing.T) {
+	cert, certFile, keyFile := writeTestCertificate(t, "client")
+	_, otherCertFile, _ := writeTestCertificate(t, "other")
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	certPEM, _ := os.ReadFile(certFile)
+	keyPEM, _ := os.ReadFile(keyFile)
+	combined := write("combined.pem", append(certPEM, keyPEM...))
+	certDER := write("cert.der", cert.Certificate[0])
+	plainDER := write("key.der", keyDER)
+	encrypted := encryptPKCS8(t, keyDER, "secret")
+	encryptedPEM := write("enc.pem", pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted}))
+	encryptedDER := write("enc.der", encrypted)
+	p12, err := pkcs12.Modern.Encode(cert.PrivateKey, cert.Leaf, nil, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := write("client.p12", p12)
+
+	valid := map[string]clientCert{
+		"pem":           {certFile: certFile, keyFile: keyFile},
+		"combined pem":  {certFile: combined},
+		"der":           {certFile: certDER, certType: "DER", keyFile: plainDER, keyType: "DER"},
+		"encrypted pem": {certFile: certFile, keyFile: encryptedPEM, password: "secret"},
+		"encrypted der": {certFile: certDER, certType: "DER", keyFile: encryptedDER, keyType: "DER", password: "secret"},
+		"pkcs12":        {certFile: bundle, certType: "P12", password: "secret"},
+	}
+	for name, cc := range valid {
+		loaded, err := cc.load()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !loaded.Leaf.Equal(cert.Leaf) {
+			t.Errorf("%s: loaded the wrong certificate", name)
+		}
+	}
+
+	if _, err := (clientCert{certFile: certFile, keyFile: encryptedPEM}).load(); !errors.Is(err, ErrKeyPassword) {
+		t.Errorf("missing password should fail with ErrKeyPassword, got %v", err)
+	}
+	invalid := map[string]clientCert{
+		"wrong password":  {certFile: certFile, keyFile: encryptedPEM, password: "wrong"},
+		"wrong p12 pass":  {certFile: bundle, certType: "P12", password: "wrong"},
+		"mismatched key":  {certFile: otherCertFile, keyFile: keyFile},
+		"missing file":    {certFile: filepath.Join(dir, "missing.pem")},
+		"unknown type":    {certFile: certFile, certType: "ENG"},
+		"der without key": {certFile: certDER, certType: "DER"},
+	}
+	for name, cc := range invalid {
+		if _, err := cc.load(); err == nil {
+			t.Errorf("%s should fail", name)
+		}
+	}
+}
+
+func TestClientCertAllVersions(t *testing.T) {
+	_, certFile, keyFile := writeTestCertificate(t, "client")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	})
+	serverCert, _, _ := writeTestCertificate(t, "server")
+	tcpURL, h3URL := newTestServers(t, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequestClientCert,
+	}, handler)
+
+	targets := map[string]string{
+		"1.1": tcpURL,
+		"2":   tcpURL,
+		"3":   h3URL,
+	}
+	for version, target := range targets {
+		resp, err := NewClient().SetHTTPVersion(version).SetInsecure(true).
+			SetCrt(certFile, keyFile).Get(target)
+		if err != nil {
+			t.Fatalf("HTTP/%s: %v", version, err)
+		}
+		if string(resp.Body) != "client" {
+			t.Errorf("HTTP/%s didn't send the client certificate: %d %s", version, resp.StatusCode, resp.Body)
+		}
+
+		_, err = NewClient().SetHTTPVersion(version).SetInsecure(true).
+			SetCrt(certFile, filepath.Join(t.TempDir(), "missing.pem")).Get(target)
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("HTTP/%s: missing key should fail the request, got %v", version, err)
+		}
+	}
+}
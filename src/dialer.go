@@ -0,0 +1,202 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	ErrFastOpen        = errors.New("TCP Fast Open is not supported on this platform")
+	ErrHTTP3UnixSocket = errors.New("HTTP/3 needs UDP, it can't use a Unix socket")
+)
+
+// socketOptions are the source address and socket options of the
+// connections of every transport.
+type socketOptions struct {
+	iface       string        // interface name, IP address or host name to connect from
+	localPort   string        // source port or range, "port[-port]"
+	tcpDelay    bool          // keep Nagle's algorithm, TCP_NODELAY is set by default
+	keepAlive   time.Duration // idle time before keepalive probes, 0 for Go's default
+	noKeepAlive bool
+	fastOpen    bool
+}
+
+// sourceIP returns the address to connect to remote from, nil for any.
+// Interfaces give their first usable address of the family of remote.
+func (s socketOptions) sourceIP(remote net.IP) (net.IP, error) {
+	if s.iface == "" {
+		return nil, nil
+	}
+	if ip := net.ParseIP(s.iface); ip != nil {
+		return ip, nil
+	}
+	var candidates []net.IP
+	if iface, err := net.InterfaceByName(s.iface); err == nil {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				candidates = append(candidates, ipNet.IP)
+			}
+		}
+	} else {
+		ips, err := net.DefaultResolver.LookupIP(context.Background(), "ip", s.iface)
+		if err != nil {
+			return nil, fmt.Errorf("interface %s: no such interface or host", s.iface)
+		}
+		candidates = ips
+	}
+	if ip := matchingSourceIP(candidates, remote); ip != nil {
+		return ip, nil
+	}
+	family := "IPv6"
+	if remote.To4() != nil {
+		family = "IPv4"
+	}
+	return nil, fmt.Errorf("interface %s has no %s address to reach %s", s.iface, family, remote)
+}
+
+// matchingSourceIP returns the first of candidates in the family of remote.
+// Link-local addresses, like fe80::, only reach link-local remotes.
+func matchingSourceIP(candidates []net.IP, remote net.IP) net.IP {
+	for _, ip := range candidates {
+		if (ip.To4() != nil) == (remote.To4() != nil) &&
+			ip.IsLinkLocalUnicast() == remote.IsLinkLocalUnicast() {
+			return ip
+		}
+	}
+	return nil
+}
+
+// ports returns the range of source ports, 0 to 0 for any.
+func (s socketOptions) ports() (int, int, error) {
+	if s.localPort == "" {
+		return 0, 0, nil
+	}
+	from, to, isRange := strings.Cut(s.localPort, "-")
+	first, err := strconv.Atoi(from)
+	last := first
+	if err == nil && isRange {
+		last, err = strconv.Atoi(to)
+	}
+	if err != nil || first < 1 || last > 65535 || first > last {
+		return 0, 0, fmt.Errorf("invalid local port %q, use port[-port]", s.localPort)
+	}
+	return first, last, nil
+}
+
+// control sets the socket options that have to be set before connecting.
+func (s socketOptions) control(network, address string, raw syscall.RawConn) error {
+	if !s.fastOpen || !strings.HasPrefix(network, "tcp") {
+		return nil
+	}
+	var err error
+	if ctrlErr := raw.Control(func(fd uintptr) { err = setFastOpen(fd) }); ctrlErr != nil {
+		return ctrlErr
+	}
+	return err
+}
+
+// bindPorts calls bind with each source port of the range until one isn't
+// in use.
+func (s socketOptions) bindPorts(bind func(port int) error) error {
+	first, last, err := s.ports()
+	if err != nil {
+		return err
+	}
+	for port := first; ; port++ {
+		err = bind(port)
+		if port >= last || !errors.Is(err, syscall.EADDRINUSE) {
+			return err
+		}
+	}
+}
+
+// dialContext opens a TCP connection to addr, an IP address and port, with
+// the source address and socket options. Every TCP connection is opened here.
+func (c *Client) dialContext(ctx context.Context, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ip, err := c.sock.sourceIP(net.ParseIP(host))
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{
+		Timeout: fasthttp.DefaultDialTimeout,
+		Control: c.sock.control,
+	}
+	if c.connectTimeout > 0 {
+		dialer.Timeout = c.connectTimeout
+	}
+	switch {
+	case c.sock.noKeepAlive:
+		dialer.KeepAliveConfig = net.KeepAliveConfig{Enable: false}
+		dialer.KeepAlive = -1
+	case c.sock.keepAlive > 0:
+		dialer.KeepAliveConfig = net.KeepAliveConfig{Enable: true, Idle: c.sock.keepAlive, Interval: c.sock.keepAlive}
+	}
+
+	var conn net.Conn
+	err = c.sock.bindPorts(func(port int) error {
+		if ip != nil || port != 0 {
+			dialer.LocalAddr = &net.TCPAddr{IP: ip, Port: port}
+		}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok && c.sock.tcpDelay {
+		tcp.SetNoDelay(false)
+	}
+	return conn, nil
+}
+
+// listenPacket opens the UDP socket of a QUIC connection to addr, an IP
+// address and port, from the source address.
+func (c *Client) listenPacket(ctx context.Context, addr string) (net.PacketConn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ip, err := c.sock.sourceIP(net.ParseIP(host))
+	if err != nil {
+		return nil, err
+	}
+	var lc net.ListenConfig
+	var conn net.PacketConn
+	err = c.sock.bindPorts(func(port int) error {
+		local := &net.UDPAddr{IP: ip, Port: port}
+		conn, err = lc.ListenPacket(ctx, "udp", local.String())
+		return err
+	})
+	return conn, err
+}
+
+// dialUnix connects to the Unix socket of SetUnixSocket. Go dials abstract
+// sockets for names starting with '@'.
+func (c *Client) dialUnix() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: fasthttp.DefaultDialTimeout}
+	if c.connectTimeout > 0 {
+		dialer.Timeout = c.connectTimeout
+	}
+	conn, err := dialer.Dial("unix", c.unixSocket)
+	if err != nil {
+		return nil, err
+	}
+	c.infof("Connected to Unix socket %s", c.unixSocket)
+	return conn, nil
+}
@@ -0,0 +1,11 @@
+package src
+
+import "syscall"
+
+// tcpFastOpenConnect is TCP_FASTOPEN_CONNECT, with which connect returns
+// right away and the first write goes out with the SYN.
+const tcpFastOpenConnect = 30
+
+func setFastOpen(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpFastOpenConnect, 1)
+}
@@ -0,0 +1,101 @@
+package src
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSocketOptions(t *testing.T) {
+	for spec, want := range map[string][2]int{"": {0, 0}, "4000": {4000, 4000}, "4000-4010": {4000, 4010}} {
+		first, last, err := socketOptions{localPort: spec}.ports()
+		if err != nil || first != want[0] || last != want[1] {
+			t.Errorf("ports(%q) = %d-%d, %v, want %v", spec, first, last, err, want)
+		}
+	}
+	for _, spec := range []string{"0", "70000", "10-5", "a-b", "1-"} {
+		if _, _, err := (socketOptions{localPort: spec}).ports(); err == nil {
+			t.Errorf("ports(%q) should fail", spec)
+		}
+	}
+
+	var loopback string
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			loopback = iface.Name
+		}
+	}
+	remote := net.ParseIP("127.0.0.1")
+	if ip, err := (socketOptions{iface: loopback}).sourceIP(remote); err != nil || !ip.IsLoopback() || ip.To4() == nil {
+		t.Errorf("interface %s gave %v, %v, want its IPv4 loopback address", loopback, ip, err)
+	}
+	if ip, err := (socketOptions{iface: "127.0.0.2"}).sourceIP(remote); err != nil || !ip.Equal(net.ParseIP("127.0.0.2")) {
+		t.Errorf("an address should be used as is, got %v, %v", ip, err)
+	}
+	if _, err := (socketOptions{iface: "no-such-interface.invalid"}).sourceIP(remote); err == nil {
+		t.Error("an unknown interface should fail")
+	}
+
+	// Link-local addresses are only used for link-local remotes
+	candidates := []net.IP{net.ParseIP("fe80::1"), net.ParseIP("2001:db8::1"), net.ParseIP("192.0.2.1")}
+	for remote, want := range map[string]string{"2001:db8::2": "2001:db8::1", "fe80::2": "fe80::1", "192.0.2.2": "192.0.2.1"} {
+		if ip := matchingSourceIP(candidates, net.ParseIP(remote)); ip.String() != want {
+			t.Errorf("the source address for %s is %v, want %s", remote, ip, want)
+		}
+	}
+	if ip := matchingSourceIP(candidates[:1], net.ParseIP("2001:db8::2")); ip != nil {
+		t.Errorf("a link-local address was picked for a global remote: %v", ip)
+	}
+}
+
+func TestSourceAddressAllVersions(t *testing.T) {
+	serverCert, _, _ := writeTestCertificate(t, "server")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RemoteAddr))
+	})
+	tcpURL, h3URL := newTestServers(t, &tls.Config{Certificates: []tls.Certificate{serverCert}}, handler)
+
+	targets := map[string]string{"1.1": tcpURL, "2": tcpURL, "3": h3URL}
+	for version, target := range targets {
+		// The first port of the range is taken, so the next one is used
+		tcp, err := net.Listen("tcp", "127.0.0.2:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		taken := tcp.Addr().(*net.TCPAddr).Port
+		if version == "3" {
+			tcp.Close()
+			pc, err := net.ListenPacket("udp", "127.0.0.2:"+strconv.Itoa(taken))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pc.Close()
+		} else {
+			defer tcp.Close()
+		}
+		ports := strconv.Itoa(taken) + "-" + strconv.Itoa(taken+20)
+
+		resp, err := NewClient().SetHTTPVersion(version).SetInsecure(true).
+			SetInterface("127.0.0.2").SetLocalPort(ports).
+			SetTCPNoDelay(false).SetKeepAliveTime(30 * time.Second).Get(target)
+		if err != nil {
+			t.Fatalf("HTTP/%s: %v", version, err)
+		}
+		host, port, _ := net.SplitHostPort(string(resp.Body))
+		if n, _ := strconv.Atoi(port); host != "127.0.0.2" || n <= taken || n > taken+20 {
+			t.Errorf("HTTP/%s connected from %s, want 127.0.0.2 and a port in %s after %d", version, resp.Body, ports, taken)
+		}
+	}
+
+	if _, err := NewClient().SetInsecure(true).SetNoKeepAlive(true).SetTCPFastOpen(true).Get(tcpURL); err != nil && !errors.Is(err, ErrFastOpen) {
+		t.Errorf("TCP Fast Open: %v", err)
+	}
+	if _, err := NewClient().SetInsecure(true).SetInterface("::1").Get(tcpURL); err == nil {
+		t.Error("an IPv6 source address can't reach an IPv4 server")
+	}
+}
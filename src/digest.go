@@ -0,0 +1,160 @@
+package src
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// digestAlgorithms lists the supported RFC 7616 algorithms, strongest first.
+var digestAlgorithms = []struct {
+	name string
+	hash func() hash.Hash
+}{
+	{"SHA-512-256", sha512.New512_256},
+	{"SHA-256", sha256.New},
+	{"MD5", md5.New},
+}
+
+// digestSession keeps the server challenge and the nonce count across the
+// requests answered with it.
+type digestSession struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string // as sent by the server, e.g. "SHA-256-sess"
+	qop       string // "auth", "auth-int" or "" for RFC 2069 servers
+	userhash  bool
+	sess      bool
+	hash      func() hash.Hash
+	nc        uint32
+}
+
+// pickDigestChallenge returns the digest challenge with the strongest
+// algorithm gURL supports.
+func pickDigestChallenge(challenges []authChallenge) (authChallenge, bool) {
+	candidates := findChallenges(challenges, "Digest")
+	for _, algorithm := range digestAlgorithms {
+		for _, challenge := range candidates {
+			name := strings.TrimSuffix(strings.ToUpper(challenge.params["algorithm"]), "-SESS")
+			if name == "" {
+				name = "MD5"
+			}
+			if name == algorithm.name && challenge.params["nonce"] != "" {
+				return challenge, true
+			}
+		}
+	}
+	return authChallenge{}, false
+}
+
+func newDigestSession(challenge authChallenge) *digestSession {
+	d := &digestSession{
+		realm:     challenge.params["realm"],
+		nonce:     challenge.params["nonce"],
+		opaque:    challenge.params["opaque"],
+		algorithm: challenge.params["algorithm"],
+		userhash:  strings.EqualFold(challenge.params["userhash"], "true"),
+		hash:      md5.New,
+	}
+	name := strings.ToUpper(d.algorithm)
+	if strings.HasSuffix(name, "-SESS") {
+		d.sess = true
+		name = strings.TrimSuffix(name, "-SESS")
+	}
+	for _, algorithm := range digestAlgorithms {
+		if algorithm.name == name {
+			d.hash = algorithm.hash
+		}
+	}
+
+	// Prefer plain auth like curl does, fall back to auth-int.
+	for _, qop := range strings.Split(challenge.params["qop"], ",") {
+		switch strings.TrimSpace(qop) {
+		case "auth":
+			d.qop = "auth"
+		case "auth-int":
+			if d.qop == "" {
+				d.qop = "auth-int"
+			}
+		}
+	}
+	return d
+}
+
+func (d *digestSession) h(s string) string {
+	return d.hs([]byte(s))
+}
+
+func (d *digestSession) hs(b []byte) string {
+	hasher := d.hash()
+	hasher.Write(b)
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// authorization computes the Authorization header value for one request to
+// the request-target uri.
+func (d *digestSession) authorization(username, password, method, uri string, body []byte) (string, error) {
+	cnonce, err := newCnonce()
+	if err != nil {
+		return "", err
+	}
+	d.nc++
+	nc := fmt.Sprintf("%08x", d.nc)
+
+	ha1 := d.h(username + ":" + d.realm + ":" + password)
+	if d.sess {
+		ha1 = d.h(ha1 + ":" + d.nonce + ":" + cnonce)
+	}
+	ha2 := d.h(method + ":" + uri)
+	if d.qop == "auth-int" {
+		ha2 = d.h(method + ":" + uri + ":" + d.hs(body))
+	}
+
+	var response string
+	if d.qop == "" {
+		response = d.h(ha1 + ":" + d.nonce + ":" + ha2)
+	} else {
+		response = d.h(ha1 + ":" + d.nonce + ":" + nc + ":" + cnonce + ":" + d.qop + ":" + ha2)
+	}
+
+	if d.userhash {
+		username = d.h(username + ":" + d.realm)
+	}
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "Digest username=%s, realm=%s, nonce=%s, uri=%s",
+		quote(username), quote(d.realm), quote(d.nonce), quote(uri))
+	if d.algorithm != "" {
+		fmt.Fprintf(&b, ", algorithm=%s", d.algorithm)
+	}
+	fmt.Fprintf(&b, ", response=%s", quote(response))
+	if d.opaque != "" {
+		fmt.Fprintf(&b, ", opaque=%s", quote(d.opaque))
+	}
+	if d.qop != "" {
+		fmt.Fprintf(&b, ", qop=%s, nc=%s, cnonce=%s", d.qop, nc, quote(cnonce))
+	}
+	if d.userhash {
+		b.WriteString(", userhash=true")
+	}
+	return b.String(), nil
+}
+
+// newCnonce returns a random client nonce.
+func newCnonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// quote returns s as an HTTP quoted-string.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,99 @@
+package src
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseChallenges(t *testing.T) {
+	challenges := parseChallenges([]string{
+		`Digest realm="a, b", qop="auth,auth-int", algorithm=SHA-256, nonce="n1", Basic realm=x`,
+		`NTLM TlRMTVNTUAACAAAA==`,
+	})
+	if len(challenges) != 3 {
+		t.Fatalf("expected 3 challenges, got %d: %+v", len(challenges), challenges)
+	}
+	if challenges[0].params["realm"] != "a, b" || challenges[0].params["algorithm"] != "SHA-256" {
+		t.Errorf("wrong digest params: %+v", challenges[0].params)
+	}
+	if challenges[1].scheme != "Basic" || challenges[1].params["realm"] != "x" {
+		t.Errorf("wrong basic challenge: %+v", challenges[1])
+	}
+	if challenges[2].token68 != "TlRMTVNTUAACAAAA==" {
+		t.Errorf("wrong token68: %q", challenges[2].token68)
+	}
+}
+
+// sha256DigestServer only accepts RFC 7616 SHA-256 digest with userhash and
+// qop=auth-int for user:pass.
+func sha256DigestServer() *httptest.Server {
+	h := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		challenges := parseChallenges(r.Header.Values("Authorization"))
+		if len(challenges) == 1 {
+			p := challenges[0].params
+			body, _ := io.ReadAll(r.Body)
+			ha1 := h("user:test:pass")
+			ha2 := h(r.Method + ":" + r.URL.RequestURI() + ":" + h(string(body)))
+			expected := h(ha1 + ":" + p["nonce"] + ":" + p["nc"] + ":" + p["cnonce"] + ":auth-int:" + ha2)
+			if p["username"] == h("user:test") && p["userhash"] == "true" && p["response"] == expected {
+				w.Write([]byte("ok " + p["nc"]))
+				return
+			}
+		}
+		w.Header().Add("WWW-Authenticate", `Digest realm="test", nonce="abc", qop="auth-int", algorithm=MD5`)
+		w.Header().Add("WWW-Authenticate", `Digest realm="test", nonce="abc", qop="auth-int", algorithm=SHA-256, userhash=true`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	return server
+}
+
+func TestDigestSHA256(t *testing.T) {
+	server := sha256DigestServer()
+	defer server.Close()
+
+	for _, version := range []string{"1.1", "2"} {
+		client := NewClient().SetHTTPVersion(version).SetInsecure(true).
+			SetDigestAuth("user:pass").AddBodyBytes([]byte(`{"a":1}`))
+		resp, err := client.Post(server.URL + "/path?q=1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || string(resp.Body) != "ok 00000001" {
+			t.Fatalf("digest auth over HTTP/%s failed: %d %s", version, resp.StatusCode, resp.Body)
+		}
+		resp, err = client.Post(server.URL + "/path?q=1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(resp.Body) != "ok 00000002" {
+			t.Errorf("nonce count should increase, got %s", resp.Body)
+		}
+	}
+}
+
+func TestDigestMD5(t *testing.T) {
+	d := newDigestSession(authChallenge{params: map[string]string{
+		"realm": "testrealm@host.com", "nonce": "dcd98b7102dd2f0e8b11d0f600bfb0c093",
+		"qop": "auth", "opaque": "5ccc069c403ebaf9f0171e9517f40e41",
+	}})
+	auth, err := d.authorization("Mufasa", "Circle Of Life", "GET", "/dir/index.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{`uri="/dir/index.html"`, `qop=auth`, `nc=00000001`, `opaque="5ccc069c403ebaf9f0171e9517f40e41"`} {
+		if !strings.Contains(auth, part) {
+			t.Errorf("%s missing in %s", part, auth)
+		}
+	}
+}
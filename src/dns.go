@@ -0,0 +1,397 @@
+package src
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsTimeout bounds a name lookup.
+const dnsTimeout = 5 * time.Second
+
+// resolver looks up host names: the system resolver, DNS servers given with
+// SetDNSServers, or a DoH server given with SetDoHURL.
+type resolver interface {
+	// lookupIP returns the addresses of host, network is "ip", "ip4" or "ip6"
+	lookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+	// lookupHTTPS returns the HTTPS records of host, RFC 9460
+	lookupHTTPS(ctx context.Context, host string) ([]dnsmessage.HTTPSResource, error)
+	String() string
+}
+
+// resolver returns the resolver the client is set up with.
+func (c *Client) resolver() (resolver, error) {
+	switch {
+	case c.dohURL != "":
+		u, err := url.Parse(c.dohURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("invalid DoH url %q, it must be an https:// url", c.dohURL)
+		}
+		return &dohServer{url: u, insecure: c.dohInsecure, timeout: c.timeout}, nil
+	case c.dnsServers != "":
+		return parseDNSServers(c.dnsServers)
+	}
+	return systemResolver{}, nil
+}
+
+// ipNetwork is the network of address lookups, limited to one address
+// family with SetIPVersion.
+func (c *Client) ipNetwork() string {
+	switch c.ipVersion {
+	case "4":
+		return "ip4"
+	case "6":
+		return "ip6"
+	}
+	return "ip"
+}
+
+// inNetwork reports whether ip belongs to network "ip", "ip4" or "ip6".
+func inNetwork(ip net.IP, network string) bool {
+	switch network {
+	case "ip4":
+		return ip.To4() != nil
+	case "ip6":
+		return ip.To4() == nil
+	}
+	return true
+}
+
+// lookupAddrs returns the addresses to connect to for addr, host:port, in
+// the order to try them. They come from --resolve or the resolver.
+func (c *Client) lookupAddrs(addr string) ([]string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	network := c.ipNetwork()
+	overrides, err := c.resolveAddrs(addr)
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	switch {
+	case overrides != nil:
+		for _, override := range overrides {
+			ip, _, _ := net.SplitHostPort(override)
+			ips = append(ips, net.ParseIP(ip))
+		}
+	case net.ParseIP(host) != nil:
+		ips = []net.IP{net.ParseIP(host)}
+	default:
+		r, err := c.resolver()
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), dnsTimeout)
+		defer cancel()
+		if ips, err = r.lookupIP(ctx, network, host); err != nil {
+			return nil, err
+		}
+		c.infof("Resolved %s to %s with %s", host, joinIPs(ips), r)
+	}
+
+	var addrs []string
+	for _, ip := range ips {
+		if inNetwork(ip, network) {
+			addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("%s has no IPv%s address", host, c.ipVersion)
+	}
+	return addrs, nil
+}
+
+func joinIPs(ips []net.IP) string {
+	s := make([]string, len(ips))
+	for i, ip := range ips {
+		s[i] = ip.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// systemResolver is the resolver of the OS, through net.DefaultResolver.
+type systemResolver struct{}
+
+func (systemResolver) lookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	return net.DefaultResolver.LookupIP(ctx, network, host)
+}
+
+// lookupHTTPS asks the nameservers of /etc/resolv.conf, net.Resolver can't
+// look up HTTPS records.
+func (systemResolver) lookupHTTPS(ctx context.Context, host string) ([]dnsmessage.HTTPSResource, error) {
+	return systemDNSServers().lookupHTTPS(ctx, host)
+}
+
+func (systemResolver) String() string {
+	return "the system resolver"
+}
+
+// systemDNSServers returns the nameservers of /etc/resolv.conf.
+func systemDNSServers() dnsServers {
+	servers := dnsServers{"127.0.0.1:53"}
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return servers
+	}
+	defer f.Close()
+	var found dnsServers
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			found = append(found, net.JoinHostPort(fields[1], "53"))
+		}
+	}
+	if len(found) == 0 {
+		return servers
+	}
+	return found
+}
+
+// dnsServers are the host:port of DNS servers, asked in turn over UDP, and
+// over TCP when the answer is truncated.
+type dnsServers []string
+
+// parseDNSServers parses the ip[:port] list of --dns-servers.
+func parseDNSServers(list string) (dnsServers, error) {
+	var servers dnsServers
+	for _, server := range strings.Split(list, ",") {
+		server = strings.TrimSpace(server)
+		host, port, err := net.SplitHostPort(server)
+		if err != nil {
+			// No port, which leaves the brackets of IPv6 addresses optional
+			host, port = strings.TrimSuffix(strings.TrimPrefix(server, "["), "]"), "53"
+		}
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("invalid DNS server %q, use ip[:port]", server)
+		}
+		servers = append(servers, net.JoinHostPort(host, port))
+	}
+	return servers, nil
+}
+
+func (s dnsServers) lookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	return lookupIP(ctx, s.exchange, network, host)
+}
+
+func (s dnsServers) lookupHTTPS(ctx context.Context, host string) ([]dnsmessage.HTTPSResource, error) {
+	return lookupHTTPS(ctx, s.exchange, host)
+}
+
+func (s dnsServers) String() string {
+	return "DNS servers " + strings.Join(s, ", ")
+}
+
+func (s dnsServers) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	err := errors.New("no DNS server")
+	for _, server := range s {
+		var resp []byte
+		if resp, err = exchangeDNS(ctx, server, query); err == nil {
+			return resp, nil
+		}
+	}
+	return nil, err
+}
+
+// exchangeDNS sends query to server over UDP, and again over TCP when the
+// answer is truncated.
+func exchangeDNS(ctx context.Context, server string, query []byte) ([]byte, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4096)
+	var header dnsmessage.Header
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Skip stray answers to other queries
+		var p dnsmessage.Parser
+		if header, err = p.Start(buf[:n]); err == nil && header.Response &&
+			header.ID == binary.BigEndian.Uint16(query) {
+			if !header.Truncated {
+				return buf[:n], nil
+			}
+			break
+		}
+	}
+
+	tcp, err := dialer.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer tcp.Close()
+	tcp.SetDeadline(deadline)
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+	if _, err := tcp.Write(append(framed, query...)); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(tcp, length[:]); err != nil {
+		return nil, err
+	}
+	answer := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(tcp, answer); err != nil {
+		return nil, err
+	}
+	return answer, nil
+}
+
+// dohServer resolves with DNS-over-HTTPS, RFC 8484, over HTTP/2.
+type dohServer struct {
+	url      *url.URL
+	insecure bool
+	timeout  time.Duration
+}
+
+func (d *dohServer) lookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	return lookupIP(ctx, d.exchange, network, host)
+}
+
+func (d *dohServer) lookupHTTPS(ctx context.Context, host string) ([]dnsmessage.HTTPSResource, error) {
+	return lookupHTTPS(ctx, d.exchange, host)
+}
+
+func (d *dohServer) String() string {
+	return "DoH " + d.url.String()
+}
+
+func (d *dohServer) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	// The ID is 0 so that HTTP caches can share answers
+	query = append([]byte{0, 0}, query[2:]...)
+	u := *d.url
+	q := u.Query()
+	q.Set("dns", base64.RawURLEncoding.EncodeToString(query))
+	u.RawQuery = q.Encode()
+
+	// The request is bounded by ctx too, so a server that never answers
+	// doesn't hang the lookup
+	timeout := dnsTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	if d.timeout > 0 && d.timeout < timeout {
+		timeout = d.timeout
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("DoH server %s: %w", d.url.Host, context.DeadlineExceeded)
+	}
+
+	// The DoH server name itself is looked up by the system resolver
+	resp, err := NewClient().SetHTTPVersion("2").SetInsecure(d.insecure).SetTimeout(timeout).
+		AddHeader("Accept", "application/dns-message").Get(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("DoH server %s: %w", d.url.Host, err)
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("DoH server %s answered with status %d", d.url.Host, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// dnsExchange sends a packed DNS query and returns the packed answer.
+type dnsExchange func(ctx context.Context, query []byte) ([]byte, error)
+
+// queryDNS asks exchange about name and type, and checks the answer.
+func queryDNS(ctx context.Context, exchange dnsExchange, host string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return nil, err
+	}
+	id := uint16(time.Now().UnixNano())
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+	answer, err := exchange(ctx, packed)
+	if err != nil {
+		return nil, err
+	}
+	var resp dnsmessage.Message
+	if err := resp.Unpack(answer); err != nil {
+		return nil, err
+	}
+	switch resp.RCode {
+	case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+		return &resp, nil
+	}
+	return nil, fmt.Errorf("DNS server answered %s for %s", resp.RCode, host)
+}
+
+// lookupIP asks exchange for the AAAA and A records of host, as network
+// allows. It fails only when no query returns an address.
+func lookupIP(ctx context.Context, exchange dnsExchange, network, host string) ([]net.IP, error) {
+	var types []dnsmessage.Type
+	if network != "ip4" {
+		types = append(types, dnsmessage.TypeAAAA)
+	}
+	if network != "ip6" {
+		types = append(types, dnsmessage.TypeA)
+	}
+	var ips []net.IP
+	var queryErr error
+	for _, qtype := range types {
+		resp, err := queryDNS(ctx, exchange, host, qtype)
+		if err != nil {
+			if queryErr == nil {
+				queryErr = err
+			}
+			continue
+		}
+		for _, answer := range resp.Answers {
+			switch body := answer.Body.(type) {
+			case *dnsmessage.AResource:
+				ips = append(ips, net.IP(body.A[:]))
+			case *dnsmessage.AAAAResource:
+				ips = append(ips, net.IP(body.AAAA[:]))
+			}
+		}
+	}
+	if len(ips) == 0 && queryErr != nil {
+		return nil, &net.DNSError{Err: queryErr.Error(), Name: host}
+	}
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return ips, nil
+}
+
+func lookupHTTPS(ctx context.Context, exchange dnsExchange, host string) ([]dnsmessage.HTTPSResource, error) {
+	resp, err := queryDNS(ctx, exchange, host, dnsmessage.TypeHTTPS)
+	if err != nil {
+		return nil, fmt.Errorf("HTTPS record of %s: %w", host, err)
+	}
+	var records []dnsmessage.HTTPSResource
+	for _, answer := range resp.Answers {
+		if https, ok := answer.Body.(*dnsmessage.HTTPSResource); ok {
+			records = append(records, *https)
+		}
+	}
+	return records, nil
+}
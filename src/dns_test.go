@@ -0,0 +1,216 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// testDNSZone holds the records of a DNS stand-in, by fully qualified name.
+type testDNSZone map[string][]dnsmessage.ResourceBody
+
+// answer returns the packed answer to the packed query, nil for garbage.
+func (z testDNSZone) answer(packed []byte) []byte {
+	var query dnsmessage.Message
+	if err := query.Unpack(packed); err != nil || len(query.Questions) != 1 {
+		return nil
+	}
+	question := query.Questions[0]
+	header := dnsmessage.Header{ID: query.ID, Response: true}
+	records, ok := z[question.Name.String()]
+	if !ok {
+		header.RCode = dnsmessage.RCodeNameError
+	}
+	b := dnsmessage.NewBuilder(nil, header)
+	b.StartQuestions()
+	b.Question(question)
+	b.StartAnswers()
+	rr := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 60}
+	for _, record := range records {
+		switch body := record.(type) {
+		case *dnsmessage.AResource:
+			if question.Type == dnsmessage.TypeA {
+				b.AResource(rr, *body)
+			}
+		case *dnsmessage.AAAAResource:
+			if question.Type == dnsmessage.TypeAAAA {
+				b.AAAAResource(rr, *body)
+			}
+		case *dnsmessage.HTTPSResource:
+			if question.Type == dnsmessage.TypeHTTPS {
+				b.HTTPSResource(rr, *body)
+			}
+		}
+	}
+	resp, _ := b.Finish()
+	return resp
+}
+
+// serveTestDNS serves zone over UDP and returns the server address.
+func serveTestDNS(t *testing.T, zone testDNSZone) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := zone.answer(buf[:n]); resp != nil {
+				conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// serveTestDoH serves zone with DNS-over-HTTPS GET requests over HTTP/2.
+func serveTestDoH(t *testing.T, zone testDNSZone) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		if err != nil || r.ProtoMajor != 2 || r.Header.Get("Accept") != "application/dns-message" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(zone.answer(query))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestResolvers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	// The internal view of split.example, the public one has no answer
+	zone := testDNSZone{"split.example.": {
+		&dnsmessage.AAAAResource{AAAA: [16]byte{15: 1}},
+		&dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+	}}
+	dns := serveTestDNS(t, zone)
+	doh := serveTestDoH(t, zone)
+	target := "http://split.example:" + port
+
+	clients := map[string]func() *Client{
+		"DNS servers": func() *Client { return NewClient().SetDNSServers(dns) },
+		"DoH": func() *Client {
+			return NewClient().SetDoHURL(doh.URL + "/dns-query").SetDoHInsecure(true)
+		},
+	}
+	for name, newClient := range clients {
+		var verbose bytes.Buffer
+		resp, err := newClient().SetIPVersion("4").SetVerbose(&verbose).Get(target)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if string(resp.Body) != "split.example:"+port {
+			t.Errorf("%s: the server saw Host %q", name, resp.Body)
+		}
+		if want := "* Resolved split.example to 127.0.0.1 with " + name; !strings.Contains(verbose.String(), want) {
+			t.Errorf("%s: verbose output is missing %q:\n%s", name, want, verbose.String())
+		}
+
+		verbose.Reset()
+		newClient().SetVerbose(&verbose).Get(target)
+		if !strings.Contains(verbose.String(), "* Resolved split.example to ::1, 127.0.0.1 with ") {
+			t.Errorf("%s: both address families should be looked up:\n%s", name, verbose.String())
+		}
+
+		var dnsErr *net.DNSError
+		if _, err := newClient().Get("http://missing.example:" + port); !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			t.Errorf("%s: unknown names should fail with a not found DNSError, got %v", name, err)
+		}
+	}
+
+	// The certificate of the DoH server is verified by default
+	if _, err := NewClient().SetDoHURL(doh.URL).Get(target); err == nil {
+		t.Error("a DoH server with an untrusted certificate should fail the request")
+	}
+	if _, err := NewClient().SetDoHURL("http://" + doh.Listener.Addr().String()).Get(target); err == nil {
+		t.Error("a DoH url without https should fail the request")
+	}
+	if _, err := NewClient().SetDNSServers("dns.example").Get(target); err == nil {
+		t.Error("DNS servers have to be IP addresses")
+	}
+
+	// The address family applies to literal and --resolve addresses too
+	if _, err := NewClient().SetIPVersion("6").Get(server.URL); err == nil {
+		t.Error("an IPv4 url should fail with --ipv6")
+	}
+	resp, err := NewClient().SetIPVersion("4").
+		SetResolve([]string{"split.example:" + port + ":::1,127.0.0.1"}).Get(target)
+	if err != nil || string(resp.Body) != "split.example:"+port {
+		t.Errorf("--ipv4 should skip the IPv6 address of --resolve: %v", err)
+	}
+}
+
+func TestLookupIP(t *testing.T) {
+	zone := testDNSZone{"split.example.": {&dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}}}}
+	// A server that fails AAAA queries
+	exchange := func(ctx context.Context, query []byte) ([]byte, error) {
+		var msg dnsmessage.Message
+		if err := msg.Unpack(query); err == nil && msg.Questions[0].Type == dnsmessage.TypeAAAA {
+			msg.Response, msg.RCode = true, dnsmessage.RCodeServerFailure
+			return msg.Pack()
+		}
+		return zone.answer(query), nil
+	}
+	ips, err := lookupIP(context.Background(), exchange, "ip", "split.example")
+	if err != nil || joinIPs(ips) != "127.0.0.1" {
+		t.Errorf("got %v, %v, want the A record despite the failing AAAA query", ips, err)
+	}
+	var dnsErr *net.DNSError
+	if _, err := lookupIP(context.Background(), exchange, "ip6", "split.example"); !errors.As(err, &dnsErr) || dnsErr.IsNotFound {
+		t.Errorf("got %v, want the AAAA failure", err)
+	}
+
+	// A DoH server that never answers is bounded by the lookup deadline
+	done := make(chan struct{})
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	defer close(done)
+	doh, _ := url.Parse(server.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := (&dohServer{url: doh, insecure: true}).lookupIP(ctx, "ip4", "split.example"); err == nil {
+		t.Error("a DoH server that never answers should fail the lookup")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("the lookup took %v", elapsed)
+	}
+}
+
+func TestParseDNSServers(t *testing.T) {
+	servers, err := parseDNSServers("10.0.0.1, 10.0.0.2:5353,::1,[2001:db8::1]:53")
+	want := dnsServers{"10.0.0.1:53", "10.0.0.2:5353", "[::1]:53", "[2001:db8::1]:53"}
+	if err != nil || strings.Join(servers, " ") != strings.Join(want, " ") {
+		t.Errorf("parseDNSServers = %v, %v, want %v", servers, err, want)
+	}
+}
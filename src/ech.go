@@ -0,0 +1,114 @@
+package src
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var ErrECHVersion = errors.New("ECH needs TLS 1.3, it can't be used with a lower maximum TLS version")
+
+// echConfigList returns the ECHConfigList for host from the --ech spec:
+// "auto" for the ech parameter of its HTTPS DNS record, a file, or base64.
+// It is nil when ECH isn't used.
+func (c *Client) echConfigList(host string) ([]byte, error) {
+	switch {
+	case c.ech == "":
+		return nil, nil
+	case c.ech == "auto":
+		if net.ParseIP(host) != nil {
+			return nil, nil
+		}
+		r, err := c.resolver()
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), dnsTimeout)
+		defer cancel()
+		records, err := r.lookupHTTPS(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			if list, ok := record.GetParam(dnsmessage.SVCParamECH); ok {
+				c.infof("Using the ECH config of the HTTPS record of %s", host)
+				return list, checkECHConfigList(list)
+			}
+		}
+		c.infof("No ECH config in the HTTPS records of %s, not using ECH", host)
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(c.ech)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err != nil {
+		data = []byte(c.ech)
+	}
+	// Files may hold the list as base64 text, like DNS tools print it
+	list, decodeErr := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if decodeErr != nil {
+		if err != nil {
+			return nil, fmt.Errorf("ECH config %q is neither auto, a file nor base64", c.ech)
+		}
+		list = data
+	}
+	return list, checkECHConfigList(list)
+}
+
+// checkECHConfigList checks the framing of an ECHConfigList, crypto/tls
+// parses the configs themselves.
+func checkECHConfigList(list []byte) error {
+	if len(list) < 2 || int(binary.BigEndian.Uint16(list)) != len(list)-2 {
+		return errors.New("invalid ECHConfigList")
+	}
+	return nil
+}
+
+// originTLSConfig is the TLS config for the origin server host, with ECH
+// when it's enabled.
+func (c *Client) originTLSConfig(host string) (*tls.Config, error) {
+	cfg, err := c.originTLS.config(host, c.infof)
+	if err != nil || c.ech == "" {
+		return cfg, err
+	}
+	if c.originTLS.maxVersion != 0 && c.originTLS.maxVersion < tls.VersionTLS13 {
+		return nil, ErrECHVersion
+	}
+	list, err := c.echConfigList(host)
+	if err != nil || list == nil {
+		return cfg, err
+	}
+	cfg.EncryptedClientHelloConfigList = list
+	cfg.MinVersion = tls.VersionTLS13
+
+	verify := cfg.VerifyConnection
+	cfg.VerifyConnection = func(state tls.ConnectionState) error {
+		if state.ECHAccepted {
+			c.infof("ECH accepted by %s", host)
+		}
+		return verify(state)
+	}
+	// A server that can't decrypt the inner hello answers as its public
+	// name, whose certificate is checked before the retry configs are
+	// trusted.
+	insecure := c.originTLS.insecure
+	cfg.EncryptedClientHelloRejectionVerify = func(state tls.ConnectionState) error {
+		c.infof("ECH rejected, %s answered as %s", host, state.ServerName)
+		if insecure {
+			return nil
+		}
+		_, err := verifyCertificate(state.PeerCertificates, cfg.RootCAs, nil, state.ServerName)
+		return err
+	}
+	return cfg, nil
+}
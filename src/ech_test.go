@@ -0,0 +1,152 @@
+package src
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newTestECHKey returns an ECHConfig for DHKEM(X25519) with
+// HKDF-SHA256/AES-128-GCM and publicName, with its server key.
+func newTestECHKey(t *testing.T, publicName string) tls.EncryptedClientHelloKey {
+	t.Helper()
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b cryptobyte.Builder
+	b.AddUint16(0xfe0d)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint8(1)       // config_id
+		b.AddUint16(0x0020) // DHKEM(X25519, HKDF-SHA256)
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(key.PublicKey().Bytes())
+		})
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint16(0x0001) // HKDF-SHA256
+			b.AddUint16(0x0001) // AES-128-GCM
+		})
+		b.AddUint8(0) // maximum_name_length
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes([]byte(publicName))
+		})
+		b.AddUint16(0) // extensions
+	})
+	return tls.EncryptedClientHelloKey{Config: b.BytesOrPanic(), PrivateKey: key.Bytes(), SendAsRetry: true}
+}
+
+// echConfigListOf wraps ECHConfigs into an ECHConfigList.
+func echConfigListOf(keys ...tls.EncryptedClientHelloKey) []byte {
+	var b cryptobyte.Builder
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, key := range keys {
+			b.AddBytes(key.Config)
+		}
+	})
+	return b.BytesOrPanic()
+}
+
+func TestECHAllVersions(t *testing.T) {
+	serverCert, _, _ := writeTestCertificate(t, "server")
+	echKey := newTestECHKey(t, "public.example")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS.ECHAccepted {
+			w.Write([]byte("ech"))
+		}
+	})
+	tcpURL, h3URL := newTestServers(t, &tls.Config{
+		Certificates:             []tls.Certificate{serverCert},
+		EncryptedClientHelloKeys: []tls.EncryptedClientHelloKey{echKey},
+	}, handler)
+
+	// ECH needs a server name, so requests go to localhost
+	localhost := strings.NewReplacer("127.0.0.1", "localhost")
+	targets := map[string]string{
+		"1.1": localhost.Replace(tcpURL),
+		"2":   localhost.Replace(tcpURL),
+		"3":   localhost.Replace(h3URL),
+	}
+	configFile := filepath.Join(t.TempDir(), "ech.conf")
+	if err := os.WriteFile(configFile, echConfigListOf(echKey), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(echConfigListOf(echKey))
+	wrongList := base64.StdEncoding.EncodeToString(echConfigListOf(newTestECHKey(t, "public.example")))
+
+	for version, target := range targets {
+		for _, spec := range []string{configFile, encoded} {
+			var verbose bytes.Buffer
+			resp, err := NewClient().SetHTTPVersion(version).SetInsecure(true).
+				SetECH(spec).SetVerbose(&verbose).Get(target)
+			if err != nil {
+				t.Fatalf("HTTP/%s: %v", version, err)
+			}
+			if string(resp.Body) != "ech" {
+				t.Errorf("HTTP/%s: the server didn't accept ECH", version)
+			}
+			if !strings.Contains(verbose.String(), "* ECH accepted by localhost\n") {
+				t.Errorf("HTTP/%s: verbose output doesn't show ECH:\n%s", version, verbose.String())
+			}
+		}
+
+		// The server can't decrypt a hello for another key and answers as
+		// its public name, with retry configs
+		var verbose bytes.Buffer
+		_, err := NewClient().SetHTTPVersion(version).SetInsecure(true).
+			SetECH(wrongList).SetVerbose(&verbose).Get(target)
+		var rejected *tls.ECHRejectionError
+		if !errors.As(err, &rejected) || len(rejected.RetryConfigList) == 0 {
+			t.Errorf("HTTP/%s: rejected ECH should fail with retry configs, got %v", version, err)
+		}
+		if !strings.Contains(verbose.String(), "* ECH rejected, localhost answered as public.example\n") {
+			t.Errorf("HTTP/%s: verbose output doesn't show the rejection:\n%s", version, verbose.String())
+		}
+	}
+
+	if _, err := NewClient().SetECH("not an ECH config").Get(targets["1.1"]); err == nil {
+		t.Error("an invalid ECH config should fail the request")
+	}
+	if _, err := NewClient().SetInsecure(true).SetECH(encoded).
+		SetTLSVersion(0, tls.VersionTLS12).Get(targets["1.1"]); !errors.Is(err, ErrECHVersion) {
+		t.Errorf("ECH with TLS 1.2 should fail with ErrECHVersion, got %v", err)
+	}
+}
+
+func TestECHConfigListAuto(t *testing.T) {
+	list := echConfigListOf(newTestECHKey(t, "public.example"))
+	https := &dnsmessage.HTTPSResource{SVCBResource: dnsmessage.SVCBResource{Priority: 1, Target: dnsmessage.MustNewName(".")}}
+	https.SetParam(dnsmessage.SVCParamECH, list)
+	dns := serveTestDNS(t, testDNSZone{"ech.example.": {https}})
+
+	var verbose bytes.Buffer
+	c := NewClient().SetECH("auto").SetVerbose(&verbose).SetDNSServers(dns)
+	got, err := c.echConfigList("ech.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, list) {
+		t.Errorf("got ECH config %x, want %x", got, list)
+	}
+
+	// Without a record the request goes on without ECH
+	if got, err := c.echConfigList("plain.example"); err != nil || got != nil {
+		t.Errorf("a host without HTTPS record should not use ECH, got %x, %v", got, err)
+	}
+	if !strings.Contains(verbose.String(), "* No ECH config in the HTTPS records of plain.example, not using ECH\n") {
+		t.Errorf("verbose output doesn't explain the missing ECH config:\n%s", verbose.String())
+	}
+	if got, err := c.echConfigList("127.0.0.1"); err != nil || got != nil {
+		t.Errorf("IP addresses should not use ECH, got %x, %v", got, err)
+	}
+}
@@ -0,0 +1,162 @@
+package src
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// h2cSettings are sent in the HTTP2-Settings header of the Upgrade request,
+// and again once the connection has switched to HTTP/2.
+var h2cSettings = []http2.Setting{{ID: http2.SettingEnablePush, Val: 0}}
+
+// encodeH2CSettings returns the HTTP2-Settings value, a SETTINGS frame
+// payload in base64url.
+func encodeH2CSettings(settings []http2.Setting) string {
+	var payload []byte
+	for _, s := range settings {
+		payload = binary.BigEndian.AppendUint16(payload, uint16(s.ID))
+		payload = binary.BigEndian.AppendUint32(payload, s.Val)
+	}
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+// upgradeRoundTrip sends the first request of an h2c transport over HTTP/1.1
+// and asks the server to switch to HTTP/2, like curl does for http:// urls.
+// The next requests of the transport use whichever protocol the server
+// answered with.
+func (c *Client) upgradeRoundTrip(t *transport, url, method string, headers requestHeaders, body []byte) (*Response, error) {
+	t.upgrade = false
+	req, err := newStdRequest(url, method, headers, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade, HTTP2-Settings")
+	req.Header.Set("Upgrade", "h2c")
+	req.Header.Set("HTTP2-Settings", encodeH2CSettings(h2cSettings))
+
+	port := req.URL.Port()
+	if port == "" {
+		port = "80"
+	}
+	t.conns++
+	conn, err := c.dialOrigin(t.proxy, net.JoinHostPort(req.URL.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if c.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		c.infof("%s didn't upgrade to h2c, staying on HTTP/1.1", req.URL.Host)
+		t.std = nil
+		return newStdResponse(resp)
+	}
+	c.infof("Upgraded %s to h2c", req.URL.Host)
+	resp, err = readH2CResponse(conn, br, req)
+	if err != nil {
+		return nil, err
+	}
+	return newStdResponse(resp)
+}
+
+// readH2CResponse reads the response to an upgraded request, which the
+// server sends on stream 1 of the HTTP/2 connection it switched to.
+func readH2CResponse(conn net.Conn, r io.Reader, req *http.Request) (*http.Response, error) {
+	if _, err := io.WriteString(conn, http2.ClientPreface); err != nil {
+		return nil, err
+	}
+	framer := http2.NewFramer(conn, r)
+	framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	if err := framer.WriteSettings(h2cSettings...); err != nil {
+		return nil, err
+	}
+
+	resp := &http.Response{Proto: "HTTP/2.0", ProtoMajor: 2, Header: http.Header{}, Request: req}
+	var body bytes.Buffer
+	for done := false; !done; {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch f := frame.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				err = framer.WriteSettingsAck()
+			}
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				err = framer.WritePing(true, f.Data)
+			}
+		case *http2.GoAwayFrame:
+			if f.LastStreamID == 0 {
+				return nil, fmt.Errorf("h2c: the server refused the upgraded request, %v", f.ErrCode)
+			}
+		case *http2.RSTStreamFrame:
+			if f.StreamID == 1 {
+				return nil, http2.StreamError{StreamID: 1, Code: f.ErrCode}
+			}
+		case *http2.MetaHeadersFrame:
+			if f.StreamID != 1 {
+				break
+			}
+			done = f.StreamEnded()
+			if resp.StatusCode != 0 {
+				// Trailers
+				break
+			}
+			status, err := strconv.Atoi(f.PseudoValue("status"))
+			if err != nil {
+				return nil, fmt.Errorf("h2c: invalid :status %q", f.PseudoValue("status"))
+			}
+			if status < 200 {
+				// Informational responses come before the final one
+				continue
+			}
+			resp.StatusCode = status
+			resp.Status = strconv.Itoa(status) + " " + http.StatusText(status)
+			for _, field := range f.RegularFields() {
+				resp.Header.Add(http.CanonicalHeaderKey(field.Name), field.Value)
+			}
+		case *http2.DataFrame:
+			if f.StreamID != 1 {
+				break
+			}
+			body.Write(f.Data())
+			done = f.StreamEnded()
+			// Padding counts against the flow control windows too
+			if n := f.Header().Length; n > 0 && !done {
+				if err = framer.WriteWindowUpdate(0, n); err == nil {
+					err = framer.WriteWindowUpdate(1, n)
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	framer.WriteGoAway(1, http2.ErrCodeNo, nil)
+
+	resp.ContentLength = int64(body.Len())
+	resp.Body = io.NopCloser(&body)
+	return resp, nil
+}
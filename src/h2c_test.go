@@ -0,0 +1,76 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestH2C(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Proto", r.Proto)
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "upgraded"})
+		fmt.Fprintf(w, "%s %s %s", r.URL.Path, r.Header.Get("X-Test"), body)
+	})
+	upgrading := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer upgrading.Close()
+
+	// --http2 asks for an Upgrade and gets the response on stream 1
+	var verbose bytes.Buffer
+	resp, err := NewClient().SetHTTPVersion("2").SetVerbose(&verbose).SetFollowRedirects(true).
+		AddHeader("X-Test", "header").AddBodyBytes([]byte("body")).Post(upgrading.URL + "/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.Body) != "/new header " || resp.Header.Get("X-Proto") != "HTTP/2.0" || resp.Cookie.Get("session") != "upgraded" {
+		t.Errorf("got %q over %s with cookie %q", resp.Body, resp.Header.Get("X-Proto"), resp.Cookie.Get("session"))
+	}
+	if !strings.Contains(verbose.String(), "* Upgraded "+upgrading.Listener.Addr().String()+" to h2c\n") {
+		t.Errorf("verbose output doesn't show the upgrade:\n%s", verbose.String())
+	}
+	resp, err = NewClient().SetHTTPVersion("2").AddBodyBytes([]byte("body")).Post(upgrading.URL)
+	if err != nil || string(resp.Body) != "/  body" {
+		t.Errorf("POST got %q, %v", resp.Body, err)
+	}
+
+	// A server without h2c answers the Upgrade request over HTTP/1.1
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	resp, err = NewClient().SetHTTPVersion("2").Get(plain.URL)
+	if err != nil || resp.Header.Get("X-Proto") != "HTTP/1.1" {
+		t.Errorf("got %v, %v, want an HTTP/1.1 response", resp, err)
+	}
+
+	// With prior knowledge, a server that only speaks h2c is reached
+	// without an HTTP/1.1 request
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	onlyH2C := &http.Server{Handler: handler, Protocols: protocols}
+	go onlyH2C.Serve(listener)
+	defer onlyH2C.Close()
+	url := "http://" + listener.Addr().String()
+	resp, err = NewClient().SetHTTP2PriorKnowledge(true).Get(url)
+	if err != nil || resp.Header.Get("X-Proto") != "HTTP/2.0" {
+		t.Errorf("prior knowledge got %v, %v", resp, err)
+	}
+	if _, err := NewClient().SetHTTPVersion("2").Get(url); err == nil {
+		t.Error("the Upgrade request should fail on a server that only speaks h2c")
+	}
+}
@@ -0,0 +1,113 @@
+package src
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// defaultHappyEyeballsTimeout is the head start of each connection attempt
+// before the next address is tried, like curl's.
+const defaultHappyEyeballsTimeout = 200 * time.Millisecond
+
+// interleaveFamilies orders addrs by alternating address families, starting
+// with the family of the first one, RFC 8305 section 4.
+func interleaveFamilies(addrs []string) []string {
+	var first, other []string
+	isV4 := func(addr string) bool {
+		host, _, _ := net.SplitHostPort(addr)
+		return net.ParseIP(host).To4() != nil
+	}
+	for _, addr := range addrs {
+		if isV4(addr) == isV4(addrs[0]) {
+			first = append(first, addr)
+		} else {
+			other = append(other, addr)
+		}
+	}
+	ordered := make([]string, 0, len(addrs))
+	for len(first) > 0 || len(other) > 0 {
+		if len(first) > 0 {
+			ordered, first = append(ordered, first[0]), first[1:]
+		}
+		if len(other) > 0 {
+			ordered, other = append(ordered, other[0]), other[1:]
+		}
+	}
+	return ordered
+}
+
+// happyEyeballs races connections to addrs, RFC 8305. Each attempt gets a
+// head start of delay, or less when it fails, before the next one starts.
+// The first connection wins and the others are canceled or closed. Every
+// attempt's context is canceled on return, so dial must not keep using it.
+func happyEyeballs[T any](c *Client, ctx context.Context, delay time.Duration, addrs []string,
+	dial func(ctx context.Context, addr string) (T, error), discard func(T)) (T, error) {
+	type result struct {
+		conn T
+		addr string
+		err  error
+	}
+	results := make(chan result, len(addrs))
+	cancels := make(map[string]context.CancelFunc)
+	next := 0
+	start := func() {
+		addr := addrs[next]
+		next++
+		attemptCtx, cancel := context.WithCancel(ctx)
+		cancels[addr] = cancel
+		c.infof("Trying %s", addr)
+		go func() {
+			conn, err := dial(attemptCtx, addr)
+			results <- result{conn, addr, err}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var firstErr error
+	for pending := 1; pending > 0; {
+		select {
+		case <-timer.C:
+			if next < len(addrs) {
+				start()
+				pending++
+				timer.Reset(delay)
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				c.infof("Connected to %s", r.addr)
+				// The winner's context is released too: net.Dialer and
+				// quic-go only use it while connecting, not for the
+				// connection
+				for _, cancel := range cancels {
+					cancel()
+				}
+				// Attempts that connect anyway are closed
+				go func() {
+					for ; pending > 0; pending-- {
+						if late := <-results; late.err == nil {
+							discard(late.conn)
+						}
+					}
+				}()
+				return r.conn, nil
+			}
+			c.infof("Failed to connect to %s: %v", r.addr, r.err)
+			cancels[r.addr]()
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			// A failure starts the next attempt right away
+			if next < len(addrs) {
+				start()
+				pending++
+				timer.Reset(delay)
+			}
+		}
+	}
+	var zero T
+	return zero, firstErr
+}
@@ -0,0 +1,127 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInterleaveFamilies(t *testing.T) {
+	got := interleaveFamilies([]string{"[::1]:80", "[::2]:80", "[::3]:80", "10.0.0.1:80", "10.0.0.2:80"})
+	want := []string{"[::1]:80", "10.0.0.1:80", "[::2]:80", "10.0.0.2:80", "[::3]:80"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("interleaveFamilies = %v, want %v", got, want)
+	}
+}
+
+func TestHappyEyeballs(t *testing.T) {
+	const v6, v4 = "[2001:db8::1]:443", "192.0.2.1:443"
+	refused := errors.New("connection refused")
+
+	// A broken IPv6 route hangs, IPv4 wins once its head start is over
+	var verbose bytes.Buffer
+	c := NewClient().SetVerbose(&verbose)
+	canceled := make(chan struct{})
+	begin := time.Now()
+	conn, err := happyEyeballs(c, context.Background(), 50*time.Millisecond, []string{v6, v4},
+		func(ctx context.Context, addr string) (string, error) {
+			if addr == v6 {
+				<-ctx.Done()
+				close(canceled)
+				return "", ctx.Err()
+			}
+			return addr, nil
+		}, func(string) {})
+	if err != nil || conn != v4 {
+		t.Fatalf("got %q, %v, want the IPv4 connection", conn, err)
+	}
+	if elapsed := time.Since(begin); elapsed < 50*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("IPv4 started after %v, want the 50ms head start", elapsed)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(2 * time.Second):
+		t.Error("the IPv6 attempt wasn't canceled")
+	}
+	for _, line := range []string{"* Trying " + v6 + "\n", "* Trying " + v4 + "\n", "* Connected to " + v4 + "\n"} {
+		if !strings.Contains(verbose.String(), line) {
+			t.Errorf("verbose output is missing %q:\n%s", line, verbose.String())
+		}
+	}
+
+	// A failure starts the next attempt without waiting. The context of
+	// the winner is released once it has connected.
+	var winner context.Context
+	deadline, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	begin = time.Now()
+	conn, err = happyEyeballs(c, deadline, time.Minute, []string{v6, v4},
+		func(ctx context.Context, addr string) (string, error) {
+			if addr == v6 {
+				return "", refused
+			}
+			winner = ctx
+			return addr, nil
+		}, func(string) {})
+	if err != nil || conn != v4 || time.Since(begin) > 2*time.Second {
+		t.Errorf("got %q, %v after %v, want the IPv4 connection right away", conn, err, time.Since(begin))
+	}
+	if winner == nil || winner.Err() == nil {
+		t.Error("the context of the winning attempt wasn't canceled")
+	}
+
+	// An attempt that connects after the winner is closed
+	discarded := make(chan string, 1)
+	conn, _ = happyEyeballs(c, context.Background(), 10*time.Millisecond, []string{v6, v4},
+		func(ctx context.Context, addr string) (string, error) {
+			if addr == v6 {
+				time.Sleep(100 * time.Millisecond)
+			}
+			return addr, nil
+		}, func(late string) { discarded <- late })
+	select {
+	case late := <-discarded:
+		if conn != v4 || late != v6 {
+			t.Errorf("won with %q and closed %q", conn, late)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("the late connection wasn't closed")
+	}
+
+	// When every address fails, the first error is returned
+	_, err = happyEyeballs(c, context.Background(), time.Minute, []string{v6, v4},
+		func(ctx context.Context, addr string) (string, error) {
+			if addr == v6 {
+				return "", refused
+			}
+			return "", errors.New("network unreachable")
+		}, func(string) {})
+	if err != refused {
+		t.Errorf("got %v, want the first error", err)
+	}
+}
+
+func TestHappyEyeballsRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	// Nothing listens on ::1, IPv4 gets its turn when that fails or the
+	// short head start is over
+	var verbose bytes.Buffer
+	_, err := NewClient().SetVerbose(&verbose).SetHappyEyeballsTimeout(10 * time.Millisecond).
+		SetResolve([]string{"dual.example:" + port + ":::1,127.0.0.1"}).Get("http://dual.example:" + port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(verbose.String(), "* Connected to 127.0.0.1:"+port+"\n") {
+		t.Errorf("verbose output doesn't show the winning address:\n%s", verbose.String())
+	}
+}
@@ -0,0 +1,30 @@
+package src
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+)
+
+// http09Status is put before HTTP/0.9 responses, which are just the body, so
+// fasthttp can parse them. The body ends when the server closes.
+const http09Status = "HTTP/0.9 200 OK\r\nConnection: close\r\n\r\n"
+
+// http09Conn is a connection whose first response may be HTTP/0.9.
+type http09Conn struct {
+	net.Conn
+	r io.Reader // nil until the first read
+}
+
+func (c *http09Conn) Read(p []byte) (int, error) {
+	if c.r == nil {
+		br := bufio.NewReader(c.Conn)
+		prefix, _ := br.Peek(len("HTTP/"))
+		c.r = br
+		if len(prefix) > 0 && !strings.HasPrefix("HTTP/", string(prefix)) {
+			c.r = io.MultiReader(strings.NewReader(http09Status), br)
+		}
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,77 @@
+package src
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// serveRaw answers every connection with reply and closes it, passing the
+// requests it read on.
+func serveRaw(t *testing.T, reply string) (string, <-chan *http.Request) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	requests := make(chan *http.Request, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if req, err := http.ReadRequest(bufio.NewReader(conn)); err == nil {
+				io.ReadAll(req.Body)
+				requests <- req
+			}
+			io.WriteString(conn, reply)
+			conn.Close()
+		}
+	}()
+	return "http://" + listener.Addr().String(), requests
+}
+
+func TestHTTP10(t *testing.T) {
+	url, requests := serveRaw(t, "HTTP/1.0 200 OK\r\n\r\nlegacy")
+	resp, err := NewClient().SetHTTPVersion("1.0").AddBodyBytes([]byte("body")).Post(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Proto != "HTTP/1.0" || string(resp.Body) != "legacy" {
+		t.Errorf("got %s %q", resp.Proto, resp.Body)
+	}
+	req := <-requests
+	if req.Proto != "HTTP/1.0" || req.Header.Get("Connection") != "close" ||
+		req.ContentLength != 4 || len(req.TransferEncoding) != 0 {
+		t.Errorf("sent %s with Connection %q, Content-Length %d and Transfer-Encoding %v",
+			req.Proto, req.Header.Get("Connection"), req.ContentLength, req.TransferEncoding)
+	}
+}
+
+func TestHTTP09(t *testing.T) {
+	url, _ := serveRaw(t, "<html>legacy</html>")
+	if _, err := NewClient().Get(url); err == nil {
+		t.Error("an HTTP/0.9 response should fail unless allowed")
+	}
+	resp, err := NewClient().SetHTTP09Allowed(true).Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Proto != "HTTP/0.9" || string(resp.Body) != "<html>legacy</html>" {
+		t.Errorf("got %d %s %q", resp.StatusCode, resp.Proto, resp.Body)
+	}
+
+	// Servers with status lines are read as usual
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "modern")
+	}))
+	defer server.Close()
+	resp, err = NewClient().SetHTTP09Allowed(true).Get(server.URL)
+	if err != nil || resp.Proto != "HTTP/1.1" || string(resp.Body) != "modern" {
+		t.Errorf("got %v, %v", resp, err)
+	}
+}
@@ -0,0 +1,49 @@
+package src
+
+import (
+	"net"
+	"strings"
+)
+
+// noProxyMatch reports whether host is in the comma separated no-proxy list,
+// with curl's rules: "*" matches every host, a name matches itself and its
+// subdomains with or without a leading dot, and an IP address matches an
+// equal address or a CIDR range.
+func noProxyMatch(list, host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(strings.Trim(host, "[]")), ".")
+	if host == "" {
+		return false
+	}
+	ip := net.ParseIP(host)
+
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(entry)), ".")
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			return true
+		case strings.Contains(entry, "/"):
+			if _, network, err := net.ParseCIDR(strings.Trim(entry, "[]")); err == nil && ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		entry = strings.Trim(entry, "[]")
+		if entryIP := net.ParseIP(entry); entryIP != nil {
+			if ip != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		if ip != nil {
+			continue
+		}
+		entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
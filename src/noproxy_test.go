@@ -0,0 +1,33 @@
+package src
+
+import "testing"
+
+func TestNoProxyMatch(t *testing.T) {
+	tests := []struct {
+		list, host string
+		match      bool
+	}{
+		{"*", "example.com", true},
+		{"example.com", "example.com", true},
+		{"example.com", "www.example.com", true},
+		{".example.com", "www.example.com", true},
+		{".example.com", "example.com", true},
+		{"*.example.com", "www.example.com", true},
+		{"example.com", "notexample.com", false},
+		{"example.com", "example.com.evil", false},
+		{"localhost, Example.COM.", "example.com", true},
+		{"192.168.0.0/16", "192.168.10.1", true},
+		{"192.168.0.0/16", "192.169.0.1", false},
+		{"10.0.0.1", "10.0.0.1", true},
+		{"10.0.0.1", "10.0.0.10", false},
+		{"::1", "[::1]", true},
+		{"fd00::/8", "fd12::1", true},
+		{"0.0.0.0/0", "example.com", false},
+		{"", "example.com", false},
+	}
+	for _, test := range tests {
+		if got := noProxyMatch(test.list, test.host); got != test.match {
+			t.Errorf("noProxyMatch(%q, %q) = %v", test.list, test.host, got)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package src
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+const (
+	ntlmNegotiateUnicode                 = 0x00000001
+	ntlmNegotiateOEM                     = 0x00000002
+	ntlmRequestTarget                    = 0x00000004
+	ntlmNegotiateNTLM                    = 0x00000200
+	ntlmNegotiateAlwaysSign              = 0x00008000
+	ntlmNegotiateExtendedSessionSecurity = 0x00080000
+	ntlmNegotiateTargetInfo              = 0x00800000
+	ntlmNegotiate128                     = 0x20000000
+	ntlmNegotiate56                      = 0x80000000
+
+	ntlmDefaultFlags = ntlmNegotiateUnicode | ntlmNegotiateOEM | ntlmRequestTarget |
+		ntlmNegotiateNTLM | ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSessionSecurity |
+		ntlmNegotiateTargetInfo | ntlmNegotiate128 | ntlmNegotiate56
+
+	ntlmAvEOL       = 0
+	ntlmAvTimestamp = 7
+)
+
+var (
+	ntlmSignature = []byte("NTLMSSP\x00")
+
+	ErrNTLMChallenge  = errors.New("invalid NTLM challenge")
+	ErrNTLMConnection = errors.New("NTLM handshake needs a persistent connection, but it was closed")
+)
+
+// ntlmChallenge is the content of the NTLM type 2 message.
+type ntlmChallenge struct {
+	flags           uint32
+	serverChallenge []byte
+	targetInfo      []byte
+}
+
+// ntlmAuthenticate runs the NTLM handshake. send transmits one message as
+// authorization header value and returns the challenges of the response, or
+// none when the peer stopped asking for authentication. All messages have to
+// travel over the same connection.
+func ntlmAuthenticate(username, password string, send func(authorization string) ([]string, error)) error {
+	challenges, err := send("NTLM " + base64.StdEncoding.EncodeToString(ntlmNegotiateMessage()))
+	if err != nil || len(challenges) == 0 {
+		return err
+	}
+
+	var token string
+	for _, challenge := range findChallenges(parseChallenges(challenges), "NTLM") {
+		if challenge.token68 != "" {
+			token = challenge.token68
+		}
+	}
+	if token == "" {
+		// The peer doesn't speak NTLM, leave its response to the caller.
+		return nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return ErrNTLMChallenge
+	}
+	challenge, err := parseNTLMChallenge(raw)
+	if err != nil {
+		return err
+	}
+
+	domain, user := splitNTLMUser(username)
+	msg, err := ntlmAuthenticateMessage(challenge, domain, user, password)
+	if err != nil {
+		return err
+	}
+	_, err = send("NTLM " + base64.StdEncoding.EncodeToString(msg))
+	return err
+}
+
+// splitNTLMUser splits a DOMAIN\user or DOMAIN/user name.
+func splitNTLMUser(username string) (string, string) {
+	if i := strings.IndexAny(username, `\/`); i >= 0 {
+		return username[:i], username[i+1:]
+	}
+	return "", username
+}
+
+// ntlmNegotiateMessage returns the type 1 message.
+func ntlmNegotiateMessage() []byte {
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], ntlmDefaultFlags)
+	// empty domain and workstation fields
+	return msg
+}
+
+// parseNTLMChallenge parses the type 2 message.
+func parseNTLMChallenge(msg []byte) (*ntlmChallenge, error) {
+	if len(msg) < 32 || !bytes.Equal(msg[:8], ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != 2 {
+		return nil, ErrNTLMChallenge
+	}
+	challenge := &ntlmChallenge{
+		flags:           binary.LittleEndian.Uint32(msg[20:]),
+		serverChallenge: msg[24:32],
+	}
+	if challenge.flags&ntlmNegotiateTargetInfo != 0 && len(msg) >= 48 {
+		length := int(binary.LittleEndian.Uint16(msg[40:]))
+		offset := int(binary.LittleEndian.Uint32(msg[44:]))
+		if offset+length > len(msg) {
+			return nil, ErrNTLMChallenge
+		}
+		challenge.targetInfo = msg[offset : offset+length]
+	}
+	return challenge, nil
+}
+
+// ntlmAuthenticateMessage returns the type 3 message with an NTLMv2 response.
+func ntlmAuthenticateMessage(challenge *ntlmChallenge, domain, user, password string) ([]byte, error) {
+	clientChallenge := make([]byte, 8)
+	if _, err := rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+
+	ntowf := ntowfv2(domain, user, password)
+	temp := make([]byte, 0, 32+len(challenge.targetInfo))
+	temp = append(temp, 1, 1, 0, 0, 0, 0, 0, 0)
+	temp = append(temp, ntlmTimestamp(challenge.targetInfo)...)
+	temp = append(temp, clientChallenge...)
+	temp = append(temp, 0, 0, 0, 0)
+	temp = append(temp, challenge.targetInfo...)
+	temp = append(temp, 0, 0, 0, 0)
+
+	ntProof := hmacMD5(ntowf, challenge.serverChallenge, temp)
+	ntResponse := append(ntProof, temp...)
+	lmResponse := append(hmacMD5(ntowf, challenge.serverChallenge, clientChallenge), clientChallenge...)
+
+	unicode := challenge.flags&ntlmNegotiateUnicode != 0
+	encode := func(s string) []byte {
+		if unicode {
+			return utf16le(s)
+		}
+		return []byte(s)
+	}
+	fields := [][]byte{lmResponse, ntResponse, encode(domain), encode(user), encode(""), nil}
+
+	const headerLen = 64
+	msg := make([]byte, headerLen)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+	offset := headerLen
+	for i, field := range fields {
+		pos := 12 + i*8
+		binary.LittleEndian.PutUint16(msg[pos:], uint16(len(field)))
+		binary.LittleEndian.PutUint16(msg[pos+2:], uint16(len(field)))
+		binary.LittleEndian.PutUint32(msg[pos+4:], uint32(offset))
+		msg = append(msg, field...)
+		offset += len(field)
+	}
+	flags := challenge.flags & ntlmDefaultFlags
+	if unicode {
+		flags &^= ntlmNegotiateOEM
+	}
+	binary.LittleEndian.PutUint32(msg[60:], flags)
+	return msg, nil
+}
+
+// ntowfv2 is the NTLMv2 one-way function of the password.
+func ntowfv2(domain, user, password string) []byte {
+	h := md4.New()
+	h.Write(utf16le(password))
+	return hmacMD5(h.Sum(nil), utf16le(strings.ToUpper(user)+domain))
+}
+
+// ntlmTimestamp returns the server timestamp of the target info, or the
+// current time, as little endian FILETIME.
+func ntlmTimestamp(targetInfo []byte) []byte {
+	for i := 0; i+4 <= len(targetInfo); {
+		id := binary.LittleEndian.Uint16(targetInfo[i:])
+		length := int(binary.LittleEndian.Uint16(targetInfo[i+2:]))
+		if id == ntlmAvEOL || i+4+length > len(targetInfo) {
+			break
+		}
+		if id == ntlmAvTimestamp && length == 8 {
+			return targetInfo[i+4 : i+12]
+		}
+		i += 4 + length
+	}
+	ts := make([]byte, 8)
+	binary.LittleEndian.PutUint64(ts, uint64(time.Now().UnixNano()/100+116444736000000000))
+	return ts
+}
+
+func hmacMD5(key []byte, data ...[]byte) []byte {
+	h := hmac.New(md5.New, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+func utf16le(s string) []byte {
+	codes := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(codes))
+	for i, code := range codes {
+		binary.LittleEndian.PutUint16(b[2*i:], code)
+	}
+	return b
+}
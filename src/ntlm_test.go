@@ -0,0 +1,201 @@
+package src
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var testServerChallenge = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+func TestNTOWFv2(t *testing.T) {
+	// MS-NLMP 4.2.4.1.1
+	got := hex.EncodeToString(ntowfv2("Domain", "User", "Password"))
+	if got != "0c868a403bfd7a93a3001ef22ef02e3f" {
+		t.Errorf("wrong NTOWFv2: %s", got)
+	}
+}
+
+// ntlmChallengeMessage builds the type 2 message of the stand-in servers.
+func ntlmChallengeMessage() string {
+	targetInfo := append([]byte{2, 0, 12, 0}, utf16le("DOMAIN")...)
+	targetInfo = append(targetInfo, 0, 0, 0, 0)
+	msg := make([]byte, 48)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 2)
+	binary.LittleEndian.PutUint32(msg[20:], ntlmNegotiateUnicode|ntlmNegotiateNTLM|ntlmNegotiateTargetInfo)
+	copy(msg[24:], testServerChallenge)
+	binary.LittleEndian.PutUint16(msg[40:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint16(msg[42:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint32(msg[44:], 48)
+	return "NTLM " + base64.StdEncoding.EncodeToString(append(msg, targetInfo...))
+}
+
+// checkNTLMAuthenticate verifies a type 3 message header against password and
+// returns the DOMAIN\user it was sent for.
+func checkNTLMAuthenticate(header, password string) (string, bool) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "NTLM "))
+	if err != nil || len(raw) < 64 || binary.LittleEndian.Uint32(raw[8:]) != 3 {
+		return "", false
+	}
+	field := func(pos int) []byte {
+		length := int(binary.LittleEndian.Uint16(raw[pos:]))
+		offset := int(binary.LittleEndian.Uint32(raw[pos+4:]))
+		return raw[offset : offset+length]
+	}
+	decode := func(b []byte) string {
+		var s []rune
+		for i := 0; i+1 < len(b); i += 2 {
+			s = append(s, rune(binary.LittleEndian.Uint16(b[i:])))
+		}
+		return string(s)
+	}
+	ntResponse, domain, user := field(20), decode(field(28)), decode(field(36))
+	proof := hmacMD5(ntowfv2(domain, user, password), testServerChallenge, ntResponse[16:])
+	return domain + `\` + user, bytes.Equal(proof, ntResponse[:16])
+}
+
+func TestNTLMServer(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		handshake = make(map[string]bool)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		auth := r.Header.Get("Authorization")
+		switch {
+		case strings.HasPrefix(auth, "NTLM TlRMTVNTUAABAAAA"):
+			handshake[r.RemoteAddr] = true
+			w.Header().Set("WWW-Authenticate", ntlmChallengeMessage())
+		case strings.HasPrefix(auth, "NTLM ") && handshake[r.RemoteAddr]:
+			if user, ok := checkNTLMAuthenticate(auth, "pass"); ok {
+				w.Write([]byte(user))
+				return
+			}
+		default:
+			w.Header().Set("WWW-Authenticate", "NTLM")
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	resp, err := NewClient().SetNTLMAuth(`DOMAIN\user:pass`).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(resp.Body) != `DOMAIN\user` {
+		t.Errorf("NTLM handshake failed: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	resp, err = NewClient().SetNTLMAuth(`DOMAIN\user:wrong`).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong password should be rejected, got %d", resp.StatusCode)
+	}
+}
+
+// ntlmProxy is a proxy stand-in that requires NTLM for CONNECT and
+// forwarded requests.
+func ntlmProxy(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveNTLMProxy(conn)
+		}
+	}()
+	return l
+}
+
+func serveNTLMProxy(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	authenticated := false
+	for {
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		auth := req.Header.Get("Proxy-Authorization")
+		challenge := "NTLM"
+		if strings.HasPrefix(auth, "NTLM TlRMTVNTUAABAAAA") {
+			challenge = ntlmChallengeMessage()
+		} else if _, ok := checkNTLMAuthenticate(auth, "pass"); ok || authenticated {
+			// NTLM authenticates the connection
+			authenticated = true
+			if req.Method == http.MethodConnect {
+				target, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					return
+				}
+				defer target.Close()
+				io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+				go io.Copy(target, br)
+				io.Copy(conn, target)
+				return
+			}
+			req.RequestURI = ""
+			req.Header.Del("Proxy-Authorization")
+			resp, err := http.DefaultTransport.RoundTrip(req)
+			if err != nil {
+				return
+			}
+			resp.Write(conn)
+			resp.Body.Close()
+			continue
+		}
+		io.Copy(io.Discard, req.Body)
+		io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n"+
+			"Proxy-Authenticate: "+challenge+"\r\nContent-Length: 0\r\n\r\n")
+	}
+}
+
+func TestNTLMProxy(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+	proxy := ntlmProxy(t)
+	defer proxy.Close()
+
+	// http:// is forwarded, https:// tunneled with CONNECT
+	for _, target := range []string{server.URL, tlsServer.URL} {
+		resp, err := NewClient().SetInsecure(true).SetProxy(proxy.Addr().String()).
+			SetProxyNTLMAuth(`DOMAIN\user:pass`).Get(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("request to %s through NTLM proxy failed: %d", target, resp.StatusCode)
+		}
+
+		_, err = NewClient().SetInsecure(true).SetProxy(proxy.Addr().String()).
+			SetProxyNTLMAuth(`DOMAIN\user:wrong`).Get(target)
+		var proxyErr *ProxyAuthError
+		if !errors.As(err, &proxyErr) {
+			t.Errorf("wrong proxy password should fail with ProxyAuthError, got %v", err)
+		}
+	}
+}
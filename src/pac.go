@@ -0,0 +1,343 @@
+package src
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/dop251/goja"
+)
+
+// pacHelpers are the PAC functions that need no access to the network,
+// written in JavaScript like the FindProxyForURL calling them.
+const pacHelpers = `
+function dnsDomainIs(host, domain) {
+	return host.length >= domain.length &&
+		host.substring(host.length - domain.length) == domain;
+}
+
+function dnsDomainLevels(host) {
+	return host.split('.').length - 1;
+}
+
+function isPlainHostName(host) {
+	return host.indexOf('.') == -1 && host.indexOf(':') == -1;
+}
+
+function localHostOrDomainIs(host, hostdom) {
+	return host == hostdom || hostdom.lastIndexOf(host + '.', 0) == 0;
+}
+
+function shExpMatch(str, shexp) {
+	var re = shexp.replace(/[.+^${}()|[\]\\]/g, '\\$&').
+		replace(/\*/g, '.*').replace(/\?/g, '.');
+	return new RegExp('^' + re + '$').test(str);
+}
+
+var pacDays = {SUN: 0, MON: 1, TUE: 2, WED: 3, THU: 4, FRI: 5, SAT: 6};
+var pacMonths = {JAN: 0, FEB: 1, MAR: 2, APR: 3, MAY: 4, JUN: 5,
+	JUL: 6, AUG: 7, SEP: 8, OCT: 9, NOV: 10, DEC: 11};
+
+// pacArgs splits off the optional trailing "GMT" argument.
+function pacArgs(args) {
+	args = Array.prototype.slice.call(args);
+	var gmt = args.length > 0 && args[args.length - 1] == 'GMT';
+	if (gmt) {
+		args.pop();
+	}
+	return {args: args, gmt: gmt, now: new Date()};
+}
+
+// pacInRange compares with wrap around, e.g. FRI to MON or 22h to 6h.
+function pacInRange(value, from, to) {
+	if (from <= to) {
+		return from <= value && value <= to;
+	}
+	return value >= from || value <= to;
+}
+
+function weekdayRange() {
+	var a = pacArgs(arguments);
+	var day = a.gmt ? a.now.getUTCDay() : a.now.getDay();
+	var from = pacDays[a.args[0]];
+	var to = a.args.length > 1 ? pacDays[a.args[1]] : from;
+	if (from === undefined || to === undefined) {
+		return false;
+	}
+	return pacInRange(day, from, to);
+}
+
+function dateRange() {
+	var a = pacArgs(arguments);
+	var now = {
+		day: a.gmt ? a.now.getUTCDate() : a.now.getDate(),
+		month: a.gmt ? a.now.getUTCMonth() : a.now.getMonth(),
+		year: a.gmt ? a.now.getUTCFullYear() : a.now.getFullYear()
+	};
+	// Each bound is a day, month and year, any of which may be missing.
+	function bound(values) {
+		var b = {};
+		for (var i = 0; i < values.length; i++) {
+			var v = values[i];
+			if (typeof v == 'string' && v in pacMonths) {
+				b.month = pacMonths[v];
+			} else if (typeof v == 'number' && v > 31) {
+				b.year = v;
+			} else if (typeof v == 'number') {
+				b.day = v;
+			}
+		}
+		return b;
+	}
+	function key(b, fields) {
+		var k = 0;
+		if ('year' in fields) k += (b.year || 0) * 10000;
+		if ('month' in fields) k += (b.month || 0) * 100;
+		if ('day' in fields) k += b.day || 0;
+		return k;
+	}
+	var n = a.args.length;
+	if (n == 0 || n > 6) {
+		return false;
+	}
+	if (n % 2 == 1 || (n == 2 && typeof a.args[0] == 'number' && typeof a.args[1] == 'string')) {
+		var single = bound(a.args);
+		return key(now, single) == key(single, single);
+	}
+	var from = bound(a.args.slice(0, n / 2));
+	var to = bound(a.args.slice(n / 2));
+	return pacInRange(key(now, from), key(from, from), key(to, from));
+}
+
+function timeRange() {
+	var a = pacArgs(arguments);
+	var h = a.gmt ? a.now.getUTCHours() : a.now.getHours();
+	var m = a.gmt ? a.now.getUTCMinutes() : a.now.getMinutes();
+	var s = a.gmt ? a.now.getUTCSeconds() : a.now.getSeconds();
+	function secs(h, m, s) {
+		return (h * 60 + m) * 60 + s;
+	}
+	var x = a.args;
+	switch (x.length) {
+	case 1:
+		return h == x[0];
+	case 2:
+		return pacInRange(h, x[0], x[1]);
+	case 4:
+		return pacInRange(secs(h, m, 0), secs(x[0], x[1], 0), secs(x[2], x[3], 0));
+	case 6:
+		return pacInRange(secs(h, m, s), secs(x[0], x[1], x[2]), secs(x[3], x[4], x[5]));
+	}
+	return false;
+}
+`
+
+// pacScript is a PAC file, loaded once by the first request that needs it.
+// The JavaScript runtime is not safe for concurrent use, calls are
+// serialized.
+type pacScript struct {
+	location string
+	load     sync.Once
+	err      error // of loading, returned to every request
+
+	mu   sync.Mutex
+	vm   *goja.Runtime
+	find goja.Callable
+	port string // of the url FindProxyForURL is called for, for --resolve
+}
+
+// loadPAC reads the PAC file at p.location, a path or a file://, http:// or
+// https:// url. Remote files are fetched without a proxy.
+func (c *Client) loadPAC(p *pacScript) error {
+	location := p.location
+	var source []byte
+	var err error
+	switch {
+	case strings.HasPrefix(location, "http://"), strings.HasPrefix(location, "https://"):
+		client := &http.Client{
+			Transport: &http.Transport{Proxy: nil},
+			Timeout:   c.timeout,
+		}
+		var resp *http.Response
+		resp, err = client.Get(location)
+		if err == nil {
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("fetching PAC file %s: status %d", location, resp.StatusCode)
+			}
+			source, err = io.ReadAll(resp.Body)
+		}
+	case strings.HasPrefix(location, "file://"):
+		var u *url.URL
+		if u, err = url.Parse(location); err == nil {
+			source, err = os.ReadFile(u.Path)
+		}
+	default:
+		source, err = os.ReadFile(location)
+	}
+	if err != nil {
+		return fmt.Errorf("loading PAC file %s: %w", location, err)
+	}
+
+	// Names are resolved like the request will be, and the script only
+	// runs under p.mu, which guards p.port
+	vm := goja.New()
+	for name, fn := range map[string]interface{}{
+		"dnsResolve":   func(host string) interface{} { return c.pacDNSResolve(host, p.port) },
+		"isResolvable": func(host string) bool { return c.pacDNSResolve(host, p.port) != nil },
+		"isInNet":      func(host, pattern, mask string) bool { return c.pacIsInNet(host, p.port, pattern, mask) },
+		"myIpAddress":  pacMyIPAddress,
+		"alert":        func(msg string) { c.infof("PAC alert: %s", msg) },
+	} {
+		if err := vm.Set(name, fn); err != nil {
+			return err
+		}
+	}
+	if _, err := vm.RunString(pacHelpers); err != nil {
+		return err
+	}
+	if _, err := vm.RunScript(location, string(source)); err != nil {
+		return fmt.Errorf("PAC file %s: %w", location, err)
+	}
+	find, ok := goja.AssertFunction(vm.Get("FindProxyForURL"))
+	if !ok {
+		return fmt.Errorf("PAC file %s doesn't define FindProxyForURL", location)
+	}
+	p.vm, p.find = vm, find
+	return nil
+}
+
+// findProxy calls FindProxyForURL and returns its result string.
+func (p *pacScript) findProxy(target *url.URL) (string, error) {
+	// Like browsers, only show the origin of https urls to the script.
+	pacURL := *target
+	pacURL.User = nil
+	if pacURL.Scheme == "https" {
+		pacURL.Path, pacURL.RawPath, pacURL.RawQuery, pacURL.Fragment = "/", "", "", ""
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.port = target.Port()
+	if p.port == "" {
+		p.port = map[string]string{"http": "80", "https": "443"}[target.Scheme]
+	}
+	result, err := p.find(goja.Undefined(), p.vm.ToValue(pacURL.String()), p.vm.ToValue(target.Hostname()))
+	if err != nil {
+		return "", fmt.Errorf("PAC file %s: %w", p.location, err)
+	}
+	return result.String(), nil
+}
+
+// pacProxies evaluates the PAC file for target.
+func (c *Client) pacProxies(target *url.URL) ([]*url.URL, error) {
+	pac := c.pac
+	pac.load.Do(func() { pac.err = c.loadPAC(pac) })
+	if pac.err != nil {
+		return nil, pac.err
+	}
+	result, err := pac.findProxy(target)
+	if err != nil {
+		return nil, err
+	}
+	proxies, err := parsePACResult(result)
+	if err != nil {
+		return nil, fmt.Errorf("PAC file %s: %w", c.proxyPAC, err)
+	}
+	c.infof("PAC file %s returned %q for %s", c.proxyPAC, result, target.Hostname())
+	return proxies, nil
+}
+
+// parsePACResult turns a FindProxyForURL result like
+// "PROXY a:8080; SOCKS b:1080; DIRECT" into proxy urls, nil for DIRECT.
+func parsePACResult(result string) ([]*url.URL, error) {
+	var proxies []*url.URL
+	for _, entry := range strings.Split(result, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		if strings.EqualFold(fields[0], "DIRECT") {
+			proxies = append(proxies, nil)
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid proxy %q", strings.TrimSpace(entry))
+		}
+		var scheme string
+		switch strings.ToUpper(fields[0]) {
+		case "PROXY", "HTTP":
+			scheme = "http"
+		case "HTTPS":
+			scheme = "https"
+		case "SOCKS", "SOCKS4":
+			scheme = "socks4"
+		case "SOCKS5":
+			scheme = "socks5"
+		default:
+			return nil, fmt.Errorf("unknown proxy type %q", fields[0])
+		}
+		proxyURL, err := parseProxyURL(scheme + "://" + fields[1])
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(proxies, proxyURL)
+	}
+	if len(proxies) == 0 {
+		// An empty result means DIRECT
+		proxies = append(proxies, nil)
+	}
+	return proxies, nil
+}
+
+// pacDNSResolve returns the first IPv4 address of host, or its first
+// address when it has none, as with --ipv6, or nil. Like the request, it
+// goes through --resolve for port and the resolver of the client.
+func (c *Client) pacDNSResolve(host, port string) interface{} {
+	addrs, err := c.lookupAddrs(net.JoinHostPort(host, port))
+	if err != nil || len(addrs) == 0 {
+		return nil
+	}
+	first, _, _ := net.SplitHostPort(addrs[0])
+	for _, addr := range addrs {
+		if ip, _, _ := net.SplitHostPort(addr); net.ParseIP(ip).To4() != nil {
+			return ip
+		}
+	}
+	return first
+}
+
+// pacIsInNet reports whether host, resolved if needed, is in the IPv4 network
+// pattern/mask.
+func (c *Client) pacIsInNet(host, port, pattern, mask string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		resolved, ok := c.pacDNSResolve(host, port).(string)
+		if !ok {
+			return false
+		}
+		ip = net.ParseIP(resolved)
+	}
+	network, maskIP := net.ParseIP(pattern).To4(), net.ParseIP(mask).To4()
+	if ip.To4() == nil || network == nil || maskIP == nil {
+		return false
+	}
+	m := net.IPMask(maskIP)
+	return ip.To4().Mask(m).Equal(network.Mask(m))
+}
+
+// pacMyIPAddress returns the address used for outgoing connections. Connecting
+// a UDP socket sends nothing.
+func pacMyIPAddress() string {
+	conn, err := net.Dial("udp4", "198.51.100.1:80")
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
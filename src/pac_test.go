@@ -0,0 +1,148 @@
+package src
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPACHelpers(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "proxy.pac")
+	script := `function FindProxyForURL(url, host) {
+		var checks = [
+			dnsDomainIs("www.example.com", ".example.com"),
+			!dnsDomainIs("www.example.org", ".example.com"),
+			dnsDomainLevels("www.example.com") == 2,
+			isPlainHostName("intranet"),
+			!isPlainHostName("intranet.example.com"),
+			localHostOrDomainIs("www", "www.example.com"),
+			localHostOrDomainIs("www.example.com", "www.example.com"),
+			!localHostOrDomainIs("www.example.org", "www.example.com"),
+			shExpMatch("http://www.example.com/a/b", "*/a/*"),
+			shExpMatch("www.example.com", "*.example.???"),
+			!shExpMatch("wwwXexample.com", "www.example.com"),
+			isInNet("10.1.2.3", "10.0.0.0", "255.0.0.0"),
+			!isInNet("11.1.2.3", "10.0.0.0", "255.0.0.0"),
+			isResolvable("127.0.0.1"),
+			dnsResolve("127.0.0.1") == "127.0.0.1",
+			dnsResolve("pac.example") == "10.9.8.7",
+			isInNet("pac.example", "10.0.0.0", "255.0.0.0"),
+			myIpAddress() != "",
+			weekdayRange("SUN", "SAT"),
+			weekdayRange("SAT", "FRI", "GMT"),
+			timeRange(0, 23),
+			timeRange(0, 0, 0, 23, 59, 59, "GMT"),
+			dateRange("JAN", "DEC"),
+			dateRange(1, 31),
+			!dateRange(1990)
+		];
+		for (var i = 0; i < checks.length; i++) {
+			if (!checks[i]) {
+				return "PROXY failed-check-" + i + ":1";
+			}
+		}
+		return "DIRECT";
+	}`
+	if err := os.WriteFile(file, []byte(script), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Names are resolved with --resolve, for the port of the url. Requests
+	// running at once share the script.
+	client := NewClient().SetProxyPAC(file).SetResolve([]string{"pac.example:80:10.9.8.7"})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			proxies, err := client.selectProxies("http://example.com/")
+			if err != nil {
+				t.Error(err)
+			} else if len(proxies) != 1 || proxies[0] != nil {
+				t.Errorf("PAC helper check failed: %v", proxies[0])
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestParsePACResult(t *testing.T) {
+	proxies, err := parsePACResult("PROXY a:8080; HTTPS b; SOCKS c:1080;SOCKS5 d:1081; DIRECT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, proxy := range proxies {
+		if proxy == nil {
+			got = append(got, "DIRECT")
+		} else {
+			got = append(got, proxy.String())
+		}
+	}
+	expected := "http://a:8080 https://b:443 socks4://c:1080 socks5://d:1081 DIRECT"
+	if strings.Join(got, " ") != expected {
+		t.Errorf("wrong PAC proxies: %v", got)
+	}
+
+	if _, err := parsePACResult("GOPHER a:70"); err == nil {
+		t.Error("unknown proxy types should be rejected")
+	}
+}
+
+func TestPACProxySelection(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	proxy := authProxy(t)
+	defer proxy.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	// The first proxy isn't listening, the second one is
+	script := fmt.Sprintf(`function FindProxyForURL(url, host) {
+		if (host == "localhost") {
+			return "DIRECT";
+		}
+		if (shExpMatch(url, "http://127.0.0.1:*")) {
+			return "PROXY %s; PROXY %s";
+		}
+		return "PROXY unused:1";
+	}`, closed.Addr(), proxy.Addr())
+	file := filepath.Join(t.TempDir(), "proxy.pac")
+	if err := os.WriteFile(file, []byte(script), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pacServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+		w.Write([]byte(script))
+	}))
+	defer pacServer.Close()
+
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	for _, location := range []string{"file://" + file, pacServer.URL + "/proxy.pac"} {
+		var verbose strings.Builder
+		client := NewClient().SetProxyPAC(location).SetProxyBasicAuth("user:pass").SetVerbose(&verbose)
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Header.Get("Via") == "" || !strings.Contains(verbose.String(), "trying the next one") {
+			t.Errorf("PAC %s should fall back to the second proxy: %q", location, verbose.String())
+		}
+
+		resp, err = client.Get("http://localhost:" + port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Header.Get("Via") != "" {
+			t.Errorf("PAC %s returned DIRECT for localhost", location)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package src
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrHTTP3Proxy is returned for HTTP/3 requests through an HTTP proxy.
+var ErrHTTP3Proxy = errors.New("HTTP/3 can't go through an HTTP proxy, use a SOCKS5 proxy or HTTP/2")
+
+// errNoRoute is returned when no proxy, not even a direct connection, was
+// selected, which selectProxies never does.
+var errNoRoute = errors.New("no proxy or direct connection to use")
+
+// ProxyAuthError reports that the proxy did not accept the credentials, as
+// opposed to errors of the origin server.
+type ProxyAuthError struct {
+	Proxy  string
+	Scheme string // authentication scheme that was tried, if any
+}
+
+func (e *ProxyAuthError) Error() string {
+	if e.Scheme == "" {
+		return fmt.Sprintf("proxy %s requires authentication", e.Proxy)
+	}
+	return fmt.Sprintf("proxy %s rejected %s authentication", e.Proxy, e.Scheme)
+}
+
+// parseProxyURL parses the proxy address, which may come without a scheme
+// or port.
+func parseProxyURL(proxy string) (*url.URL, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", proxy, err)
+	}
+	if proxyURL.Port() == "" {
+		port := "1080"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyURL.Host = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+	return proxyURL, nil
+}
+
+// proxyEnv returns the environment variable holding the proxy for scheme,
+// and its value.
+func proxyEnv(scheme string) (string, string) {
+	var names []string
+	switch scheme {
+	case "http":
+		names = []string{"http_proxy"}
+		// HTTP_PROXY can be set by a request header under CGI
+		if os.Getenv("REQUEST_METHOD") == "" {
+			names = append(names, "HTTP_PROXY")
+		}
+	case "https":
+		names = []string{"https_proxy", "HTTPS_PROXY"}
+	}
+	for _, name := range append(names, "all_proxy", "ALL_PROXY") {
+		if value := os.Getenv(name); value != "" {
+			return name, value
+		}
+	}
+	return "", ""
+}
+
+// selectProxies picks the proxies for rawUrl, to be tried in order, where
+// nil stands for a direct connection. --noproxy or NO_PROXY come first, then
+// the explicit proxy, the PAC file and the environment.
+func (c *Client) selectProxies(rawUrl string) ([]*url.URL, error) {
+	direct := []*url.URL{nil}
+	if c.unixSocket != "" {
+		return direct, nil
+	}
+	target, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	host := target.Hostname()
+
+	proxy, source := c.proxy, "--proxy"
+	if proxy == "" && c.proxyPAC == "" {
+		source, proxy = proxyEnv(strings.ToLower(target.Scheme))
+		source = "env variable " + source
+		if proxy == "" {
+			return direct, nil
+		}
+	}
+
+	noProxy, noProxySource := "", "--noproxy"
+	if c.noProxy != nil {
+		noProxy = *c.noProxy
+	} else if noProxy = os.Getenv("no_proxy"); noProxy != "" {
+		noProxySource = "no_proxy"
+	} else {
+		noProxy, noProxySource = os.Getenv("NO_PROXY"), "NO_PROXY"
+	}
+	if noProxyMatch(noProxy, host) {
+		c.infof("Host %s matches %s, not using a proxy", host, noProxySource)
+		return direct, nil
+	}
+
+	if proxy == "" {
+		return c.pacProxies(target)
+	}
+	proxyURL, err := parseProxyURL(proxy)
+	if err != nil {
+		return nil, err
+	}
+	c.infof("Uses proxy %s from %s for %s", proxyURL.Redacted(), source, host)
+	return []*url.URL{proxyURL}, nil
+}
+
+// proxyConnectError reports that the proxy itself could not be reached, in
+// which case the next proxy of a PAC result is tried.
+type proxyConnectError struct {
+	proxy string
+	err   error
+}
+
+func (e *proxyConnectError) Error() string {
+	return fmt.Sprintf("can't connect to proxy %s: %v", e.proxy, e.err)
+}
+
+func (e *proxyConnectError) Unwrap() error {
+	return e.err
+}
+
+// dialProxyHost opens the TCP connection to a proxy.
+func (c *Client) dialProxyHost(proxyURL *url.URL) (net.Conn, error) {
+	conn, err := c.dialTCP(proxyURL.Host)
+	if err != nil {
+		return nil, &proxyConnectError{proxy: proxyURL.Host, err: err}
+	}
+	return conn, nil
+}
+
+// proxyCredentials returns the proxy auth type and credentials, taken from
+// the url when --proxy-user is not given.
+func (c *Client) proxyCredentials(proxyURL *url.URL) (string, string, string) {
+	if c.proxyAuthType != "" || proxyURL.User == nil {
+		return c.proxyAuthType, c.proxyUsername, c.proxyPassword
+	}
+	password, _ := proxyURL.User.Password()
+	return "basic", proxyURL.User.Username(), password
+}
+
+// proxyAuthScheme picks the strongest scheme offered for --proxy-anyauth.
+func proxyAuthScheme(challenges []authChallenge) string {
+	if len(findChallenges(challenges, "NTLM")) > 0 {
+		return "ntlm"
+	}
+	if _, ok := pickDigestChallenge(challenges); ok {
+		return "digest"
+	}
+	if len(findChallenges(challenges, "Basic")) > 0 {
+		return "basic"
+	}
+	return ""
+}
+
+// authenticateProxy sends a request to the proxy through send, which returns
+// the challenges of a 407 response, and answers them with the configured
+// credentials. The request-target uri is used for digest.
+func (c *Client) authenticateProxy(proxyURL *url.URL, method, uri string, send func(authorization string) ([]string, error)) error {
+	authType, username, password := c.proxyCredentials(proxyURL)
+	if authType == "ntlm" {
+		return ntlmAuthenticate(username, password, send)
+	}
+
+	authorization := func(authType string) string {
+		switch authType {
+		case "basic":
+			return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+		case "digest":
+			if c.proxyDigest != nil {
+				auth, err := c.proxyDigest.authorization(username, password, method, uri, nil)
+				if err == nil {
+					return auth
+				}
+			}
+		}
+		return ""
+	}
+
+	challenges, err := send(authorization(authType))
+	if err != nil || len(challenges) == 0 || authType == "" || authType == "basic" {
+		return err
+	}
+	parsed := parseChallenges(challenges)
+	if authType == "any" {
+		authType = proxyAuthScheme(parsed)
+	}
+
+	switch authType {
+	case "ntlm":
+		return ntlmAuthenticate(username, password, send)
+	case "basic":
+		_, err = send(authorization(authType))
+	case "digest":
+		// Once more if the proxy only complained about a stale nonce.
+		for retry := 0; retry < 2 && len(challenges) > 0; retry++ {
+			challenge, ok := pickDigestChallenge(parsed)
+			if !ok || (retry > 0 && !strings.EqualFold(challenge.params["stale"], "true")) {
+				break
+			}
+			c.proxyDigest = newDigestSession(challenge)
+			challenges, err = send(authorization(authType))
+			if err != nil {
+				return err
+			}
+			parsed = parseChallenges(challenges)
+		}
+	}
+	return err
+}
+
+// proxyAuthError builds the error for a final 407 response.
+func (c *Client) proxyAuthError(proxyURL *url.URL) error {
+	authType, _, _ := c.proxyCredentials(proxyURL)
+	return &ProxyAuthError{Proxy: proxyURL.Host, Scheme: authType}
+}
+
+// tunnelConn is a connection through a CONNECT tunnel. Reads go through the
+// reader used for the proxy responses so no buffered bytes get lost.
+type tunnelConn struct {
+	net.Conn
+	br *bufio.Reader
+}
+
+func (t *tunnelConn) Read(b []byte) (int, error) {
+	return t.br.Read(b)
+}
+
+// connect sends one CONNECT request and reads the proxy response.
+func (t *tunnelConn) connect(addr, authorization string) (*http.Response, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if authorization != "" {
+		req.Header.Set("Proxy-Authorization", authorization)
+	}
+	if err := req.Write(t.Conn); err != nil {
+		return nil, err
+	}
+	resp, err := http.ReadResponse(t.br, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		// The tunnel is open, anything that follows belongs to it.
+		return resp, nil
+	}
+	// Drain the body so the next handshake message can use the connection.
+	_, err = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp, err
+}
+
+// dialProxy opens a connection to addr through the configured proxy, with a
+// CONNECT tunnel for HTTP proxies.
+func (c *Client) dialProxy(proxyURL *url.URL, addr string) (net.Conn, error) {
+	if isSOCKS(proxyURL.Scheme) {
+		return c.dialSOCKS(proxyURL, addr)
+	}
+	return c.dialTunnel(proxyURL, addr)
+}
+
+// dialProxyServer connects to an HTTP proxy, with TLS for https:// proxies.
+func (c *Client) dialProxyServer(proxyURL *url.URL) (net.Conn, error) {
+	conn, err := c.dialProxyHost(proxyURL)
+	if err != nil || proxyURL.Scheme != "https" {
+		return conn, err
+	}
+	cfg, err := c.proxyTLS.config(proxyURL.Hostname(), c.infof)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %w", proxyURL.Host, err)
+	}
+	if c.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with proxy %s: %w", proxyURL.Host, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// dialTunnel connects to the proxy and asks it to open a tunnel to addr.
+func (c *Client) dialTunnel(proxyURL *url.URL, addr string) (net.Conn, error) {
+	conn, err := c.dialProxyServer(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	if c.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	tunnel := &tunnelConn{Conn: conn, br: bufio.NewReader(conn)}
+
+	// Authentication happens on this connection before the tunnel is used,
+	// which keeps connection based schemes like NTLM working.
+	var status int
+	err = c.authenticateProxy(proxyURL, http.MethodConnect, addr, func(authorization string) ([]string, error) {
+		resp, err := tunnel.connect(addr, authorization)
+		if err != nil {
+			return nil, err
+		}
+		status = resp.StatusCode
+		if status != http.StatusProxyAuthRequired {
+			return nil, nil
+		}
+		return resp.Header.Values("Proxy-Authenticate"), nil
+	})
+	if err == nil && status == http.StatusProxyAuthRequired {
+		err = c.proxyAuthError(proxyURL)
+	} else if err == nil && status/100 != 2 {
+		err = fmt.Errorf("proxy refused CONNECT to %s with status %d", addr, status)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return tunnel, nil
+}
+
+// forwardRoundTrip sends a request in absolute-form to an HTTP proxy and
+// answers its authentication challenges.
+func (c *Client) forwardRoundTrip(t *transport, rawUrl, method string, headers requestHeaders, body []byte) (*Response, error) {
+	proxyURL := t.proxy
+	var resp *Response
+	conns := t.conns
+	err := c.authenticateProxy(proxyURL, method, rawUrl, func(authorization string) ([]string, error) {
+		hopHeaders := headers.clone()
+		if authorization != "" {
+			hopHeaders.normal.Set("Proxy-Authorization", authorization)
+		}
+		var err error
+		resp, err = c.callFastHTTP(t, rawUrl, method, hopHeaders, body)
+		if err != nil || resp.StatusCode != http.StatusProxyAuthRequired {
+			return nil, err
+		}
+		return resp.proxyAuthenticate, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if authType, _, _ := c.proxyCredentials(proxyURL); authType == "ntlm" && t.conns > max(conns, 1) {
+		return nil, ErrNTLMConnection
+	}
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		return nil, c.proxyAuthError(proxyURL)
+	}
+	return resp, nil
+}
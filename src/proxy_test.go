@@ -0,0 +1,326 @@
+package src
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// authProxy is a proxy stand-in that offers Basic and Digest and accepts
+// user:pass with either of them.
+func authProxy(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveAuthProxy(conn)
+		}
+	}()
+	return l
+}
+
+func checkProxyAuthorization(method, header string) bool {
+	if header == "Basic "+base64.StdEncoding.EncodeToString([]byte("user:pass")) {
+		return true
+	}
+	challenges := findChallenges(parseChallenges([]string{header}), "Digest")
+	if len(challenges) != 1 {
+		return false
+	}
+	p := challenges[0].params
+	h := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	ha1 := h("user:proxy:pass")
+	ha2 := h(method + ":" + p["uri"])
+	return p["response"] == h(ha1+":"+p["nonce"]+":"+p["nc"]+":"+p["cnonce"]+":auth:"+ha2)
+}
+
+func serveAuthProxy(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	for {
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		if !checkProxyAuthorization(req.Method, req.Header.Get("Proxy-Authorization")) {
+			io.Copy(io.Discard, req.Body)
+			io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n"+
+				"Proxy-Authenticate: Basic realm=\"proxy\"\r\n"+
+				"Proxy-Authenticate: Digest realm=\"proxy\", nonce=\"n\", qop=\"auth\"\r\n"+
+				"Content-Length: 0\r\n\r\n")
+			continue
+		}
+		if req.Method == http.MethodConnect {
+			target, err := net.Dial("tcp", req.Host)
+			if err != nil {
+				return
+			}
+			defer target.Close()
+			io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+			go io.Copy(target, br)
+			io.Copy(conn, target)
+			return
+		}
+		req.RequestURI = ""
+		req.Header.Del("Proxy-Authorization")
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			return
+		}
+		resp.Header.Set("Via", "1.1 proxy")
+		resp.Write(conn)
+		resp.Body.Close()
+	}
+}
+
+func TestProxyAuth(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Proxy-Authorization")))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+	proxy := authProxy(t)
+	defer proxy.Close()
+
+	clients := map[string]func() *Client{
+		"basic": func() *Client { return NewClient().SetProxyBasicAuth("user:pass") },
+		"url":   func() *Client { return NewClient().SetProxy("http://user:pass@" + proxy.Addr().String()) },
+		"digest": func() *Client {
+			return NewClient().SetProxyDigestAuth("user:pass")
+		},
+		"anyauth": func() *Client { return NewClient().SetProxyAnyAuth("user:pass") },
+	}
+	for name, newClient := range clients {
+		for _, target := range []string{server.URL, tlsServer.URL} {
+			client := newClient().SetInsecure(true)
+			if name != "url" {
+				client.SetProxy(proxy.Addr().String())
+			}
+			resp, err := client.Get(target)
+			if err != nil {
+				t.Fatalf("%s proxy auth to %s failed: %v", name, target, err)
+			}
+			if resp.StatusCode != http.StatusOK || len(resp.Body) != 0 {
+				t.Errorf("%s proxy auth to %s: %d %q", name, target, resp.StatusCode, resp.Body)
+			}
+		}
+	}
+
+	for _, target := range []string{server.URL, tlsServer.URL} {
+		_, err := NewClient().SetInsecure(true).SetProxy(proxy.Addr().String()).
+			SetProxyDigestAuth("user:wrong").Get(target)
+		var proxyErr *ProxyAuthError
+		if !errors.As(err, &proxyErr) || !strings.Contains(err.Error(), "digest") {
+			t.Errorf("expected ProxyAuthError for digest, got %v", err)
+		}
+	}
+}
+
+func TestProxyHTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto + " " + r.Header.Get("Proxy-Authorization")))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	proxy := authProxy(t)
+	defer proxy.Close()
+
+	for _, userPass := range []string{"user:pass", "user:wrong"} {
+		resp, err := NewClient().SetHTTPVersion("2").SetInsecure(true).
+			SetProxy(proxy.Addr().String()).SetProxyDigestAuth(userPass).Get(server.URL)
+		if userPass == "user:wrong" {
+			var proxyErr *ProxyAuthError
+			if !errors.As(err, &proxyErr) {
+				t.Errorf("expected ProxyAuthError over HTTP/2, got %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(resp.Body) != "HTTP/2.0 " {
+			t.Errorf("HTTP/2 through the proxy: %q", resp.Body)
+		}
+	}
+
+	_, err := NewClient().SetHTTPVersion("3").SetInsecure(true).
+		SetProxy(proxy.Addr().String()).Get(server.URL)
+	if !errors.Is(err, ErrHTTP3Proxy) {
+		t.Errorf("HTTP/3 through an HTTP proxy should fail with ErrHTTP3Proxy, got %v", err)
+	}
+}
+
+func TestProxyTunnel(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	proxy := authProxy(t)
+	defer proxy.Close()
+
+	for _, tunnel := range []bool{false, true} {
+		resp, err := NewClient().SetProxy(proxy.Addr().String()).SetProxyBasicAuth("user:pass").
+			SetProxyTunnel(tunnel).Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if forwarded := resp.Header.Get("Via") != ""; forwarded == tunnel {
+			t.Errorf("proxytunnel %v: request was forwarded: %v", tunnel, forwarded)
+		}
+	}
+}
+
+func TestProxyEnvironment(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	proxy := authProxy(t)
+	defer proxy.Close()
+	other := authProxy(t)
+	defer other.Close()
+
+	t.Setenv("http_proxy", "")
+	t.Setenv("HTTP_PROXY", "user:pass@"+proxy.Addr().String())
+	t.Setenv("no_proxy", "")
+	t.Setenv("NO_PROXY", "")
+
+	var verbose strings.Builder
+	resp, err := NewClient().SetVerbose(&verbose).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header.Get("Via") == "" || !strings.Contains(verbose.String(), "from env variable HTTP_PROXY") {
+		t.Errorf("HTTP_PROXY wasn't used: %q", verbose.String())
+	}
+
+	// --proxy wins over the environment
+	resp, err = NewClient().SetProxy("http://user:wrong@" + other.Addr().String()).Get(server.URL)
+	var proxyErr *ProxyAuthError
+	if !errors.As(err, &proxyErr) || proxyErr.Proxy != other.Addr().String() {
+		t.Errorf("explicit proxy should be used, got %v", err)
+	}
+
+	for _, noProxy := range []string{"127.0.0.0/8", "*", "127.0.0.1"} {
+		t.Setenv("NO_PROXY", noProxy)
+		verbose.Reset()
+		resp, err = NewClient().SetVerbose(&verbose).Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Header.Get("Via") != "" || !strings.Contains(verbose.String(), "matches NO_PROXY") {
+			t.Errorf("NO_PROXY=%s should bypass the proxy: %q", noProxy, verbose.String())
+		}
+	}
+
+	// --noproxy overrides NO_PROXY
+	resp, err = NewClient().SetNoProxy("example.com").Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header.Get("Via") == "" {
+		t.Error("--noproxy should replace NO_PROXY")
+	}
+}
+
+func TestHTTPSProxy(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	tlsServer := httptest.NewUnstartedServer(handler)
+	tlsServer.EnableHTTP2 = true
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	proxyCert, proxyCertFile, _ := writeTestCertificate(t, "proxy")
+	clientCert, clientCertFile, clientKeyFile := writeTestCertificate(t, "client")
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert.Leaf)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{proxyCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+		MaxVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveAuthProxy(conn)
+		}
+	}()
+	proxyURL := "https://user:pass@" + l.Addr().String()
+	newClient := func() *Client {
+		return NewClient().SetInsecure(true).SetProxy(proxyURL).
+			SetProxyCACert(proxyCertFile).SetProxyCert(clientCertFile, clientKeyFile)
+	}
+
+	for _, version := range []string{"1.1", "2"} {
+		for _, target := range []string{server.URL, tlsServer.URL} {
+			if version == "2" && target == server.URL {
+				continue
+			}
+			resp, err := newClient().SetHTTPVersion(version).Get(target)
+			if err != nil {
+				t.Fatalf("HTTP/%s to %s through HTTPS proxy: %v", version, target, err)
+			}
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("HTTP/%s to %s through HTTPS proxy: %d", version, target, resp.StatusCode)
+			}
+		}
+	}
+
+	// The origin's TLS settings don't apply to the proxy and the other way round
+	var unknownAuthority x509.UnknownAuthorityError
+	_, err = NewClient().SetInsecure(true).SetProxy(proxyURL).Get(server.URL)
+	if !errors.As(err, &unknownAuthority) {
+		t.Errorf("unknown proxy CA should fail, got %v", err)
+	}
+	var originAuthority x509.UnknownAuthorityError
+	_, err = NewClient().SetProxy(proxyURL).SetProxyInsecure(true).
+		SetProxyCert(clientCertFile, clientKeyFile).Get(tlsServer.URL)
+	if !errors.As(err, &originAuthority) {
+		t.Errorf("--proxy-insecure shouldn't skip the origin verification, got %v", err)
+	}
+
+	sum := sha256.Sum256(proxyCert.Leaf.RawSubjectPublicKeyInfo)
+	pin := "sha256//" + base64.StdEncoding.EncodeToString(sum[:])
+	if _, err := newClient().SetProxyPinnedPubKey(pin).Get(server.URL); err != nil {
+		t.Errorf("pinned proxy key should match: %v", err)
+	}
+	_, err = newClient().SetProxyPinnedPubKey("sha256//" + base64.StdEncoding.EncodeToString(make([]byte, 32))).Get(server.URL)
+	if !errors.Is(err, ErrPinnedPubKey) {
+		t.Errorf("wrong pinned proxy key should fail with ErrPinnedPubKey, got %v", err)
+	}
+
+	if _, err := newClient().SetProxyTLSVersion(tls.VersionTLS13, 0).Get(server.URL); err == nil {
+		t.Error("TLS 1.3 should be refused by a TLS 1.2 proxy")
+	}
+}
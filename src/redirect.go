@@ -0,0 +1,103 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	defaultMaxRedirects = 50
+
+	defaultRedirectProtocols = []string{"http", "https"}
+
+	ErrTooManyRedirects = errors.New("maximum redirects followed")
+	ErrRedirectProtocol = errors.New("protocol not allowed on redirect")
+)
+
+// Redirect describes one followed hop of a redirect chain.
+type Redirect struct {
+	StatusCode int
+	Method     string // method of the request that got redirected
+	URL        string // url of the request that got redirected
+	Location   string // absolute url the client went on to
+}
+
+// isRedirect reports whether status code is a redirect the client can follow.
+func isRedirect(statusCode int) bool {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// redirectMethod returns the method to use after the given redirect status. The
+// second return value is false when the request body has to be dropped.
+func (c *Client) redirectMethod(statusCode int, method string) (string, bool) {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound:
+		// Browsers switch POST to GET on 301/302, curl does the same unless
+		// --post301/--post302 is given. Other methods are kept.
+		if method == http.MethodPost && !c.postRedirects[statusCode] {
+			return http.MethodGet, false
+		}
+	case http.StatusSeeOther:
+		if method != http.MethodGet && method != http.MethodHead && !c.postRedirects[statusCode] {
+			return http.MethodGet, false
+		}
+	}
+	return method, true
+}
+
+// redirectLocation resolves the location header against the current url and
+// checks that its scheme is allowed by --proto-redir.
+func (c *Client) redirectLocation(current, location string) (*url.URL, error) {
+	base, err := url.Parse(current)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect location %q: %w", location, err)
+	}
+	next := base.ResolveReference(ref)
+	for _, p := range c.redirProtocols {
+		if strings.EqualFold(p, next.Scheme) {
+			return next, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrRedirectProtocol, next.Scheme)
+}
+
+// sameOrigin reports whether both urls share scheme, host and port.
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Host, b.Host)
+}
+
+// withoutCredentials returns a copy of headers without the ones that carry
+// user credentials, used when a redirect leaves the original host.
+func (h requestHeaders) withoutCredentials() requestHeaders {
+	ret := h.clone()
+	for key := range ret.normal.Mapper {
+		if strings.EqualFold(key, "Authorization") || strings.EqualFold(key, "Cookie") {
+			delete(ret.normal.Mapper, key)
+		}
+	}
+	return ret
+}
+
+// withoutBody returns a copy of headers without the ones that describe a
+// request body, used when a redirect switches the method to GET.
+func (h requestHeaders) withoutBody() requestHeaders {
+	ret := h.clone()
+	for key := range ret.normal.Mapper {
+		if strings.EqualFold(key, "Content-Type") || strings.EqualFold(key, "Content-Length") {
+			delete(ret.normal.Mapper, key)
+		}
+	}
+	return ret
+}
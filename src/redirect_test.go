@@ -0,0 +1,95 @@
+package src
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectChain(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/b", http.StatusFound)
+	})
+	mux.HandleFunc("/b", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/c", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/c", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := NewClient().SetFollowRedirects(true).AddBodyBytes([]byte("a=b&c=d")).Post(server.URL + "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Redirects) != 2 {
+		t.Fatalf("expected 2 redirects, got %d", len(resp.Redirects))
+	}
+	if string(resp.Body) != http.MethodGet {
+		t.Errorf("POST should switch to GET after 302, got %s", resp.Body)
+	}
+
+	resp, err = NewClient().SetFollowRedirects(true).SetPostRedirects(false, true, false).
+		AddBodyBytes([]byte("a=b&c=d")).Post(server.URL + "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.Body) != http.MethodPost {
+		t.Errorf("--post302 should keep POST, got %s", resp.Body)
+	}
+}
+
+func TestRedirectLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusMovedPermanently)
+	}))
+	defer server.Close()
+
+	_, err := NewClient().SetFollowRedirects(true).SetMaxRedirects(3).Get(server.URL)
+	if !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("expected ErrTooManyRedirects, got %v", err)
+	}
+
+	resp, err := NewClient().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("redirect should not be followed without --location, got %d", resp.StatusCode)
+	}
+}
+
+func TestRedirectCredentials(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other.URL, http.StatusFound)
+	}))
+	defer server.Close()
+
+	resp, err := NewClient().SetFollowRedirects(true).SetBasicAuth("user:pass").Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Body) != 0 {
+		t.Errorf("credentials leaked to another host: %s", resp.Body)
+	}
+
+	resp, err = NewClient().SetFollowRedirects(true).SetLocationTrusted(true).SetBasicAuth("user:pass").Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Body) == 0 {
+		t.Error("--location-trusted should keep credentials")
+	}
+
+	_, err = NewClient().SetFollowRedirects(true).SetRedirectProtocols([]string{"https"}).Get(server.URL)
+	if !errors.Is(err, ErrRedirectProtocol) {
+		t.Errorf("expected ErrRedirectProtocol, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package src
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// resolveEntry is a --resolve entry, the addresses to connect to for
+// host:port. host "*" matches every host.
+type resolveEntry struct {
+	host, port string
+	addrs      []string // host:port, tried in order
+	remove     bool     // -host:port drops the earlier entries
+}
+
+// connectToEntry is a --connect-to entry, connections to host:port go to
+// toHost:toPort. Empty fields match anything or keep the original.
+type connectToEntry struct {
+	host, port     string
+	toHost, toPort string
+}
+
+// cutHost splits s at the ':' after its first field, which may be an IPv6
+// address in brackets.
+func cutHost(s string) (host, rest string, ok bool) {
+	if strings.HasPrefix(s, "[") {
+		end := strings.Index(s, "]")
+		if end < 0 || !strings.HasPrefix(s[end+1:], ":") {
+			return "", "", false
+		}
+		return s[1:end], s[end+2:], true
+	}
+	return strings.Cut(s, ":")
+}
+
+// validPort reports whether port is a port number, 1 to 65535.
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
+
+// parseResolve parses [+|-]host:port:addr[,addr]... entries.
+func parseResolve(entry string) (resolveEntry, error) {
+	var r resolveEntry
+	spec := entry
+	switch {
+	case strings.HasPrefix(spec, "-"):
+		r.remove = true
+		spec = spec[1:]
+	case strings.HasPrefix(spec, "+"):
+		// Entries don't time out here, the + prefix only matters to curl
+		spec = spec[1:]
+	}
+	host, rest, ok := cutHost(spec)
+	if !ok || host == "" {
+		return r, fmt.Errorf("invalid --resolve %q, use host:port:addr[,addr]", entry)
+	}
+	r.host = strings.ToLower(host)
+	r.port, rest, ok = strings.Cut(rest, ":")
+	if !validPort(r.port) || ok == r.remove {
+		return r, fmt.Errorf("invalid --resolve %q, use host:port:addr[,addr]", entry)
+	}
+	if r.remove {
+		return r, nil
+	}
+	for _, addr := range strings.Split(rest, ",") {
+		addr = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(addr), "["), "]")
+		if net.ParseIP(addr) == nil {
+			return r, fmt.Errorf("invalid address %q in --resolve %q", addr, entry)
+		}
+		r.addrs = append(r.addrs, net.JoinHostPort(addr, r.port))
+	}
+	return r, nil
+}
+
+// parseConnectTo parses HOST1:PORT1:HOST2:PORT2 entries.
+func parseConnectTo(entry string) (connectToEntry, error) {
+	var e connectToEntry
+	invalid := fmt.Errorf("invalid --connect-to %q, use HOST1:PORT1:HOST2:PORT2", entry)
+	host, rest, ok := cutHost(entry)
+	if !ok {
+		return e, invalid
+	}
+	e.host = strings.ToLower(host)
+	if e.port, rest, ok = strings.Cut(rest, ":"); !ok {
+		return e, invalid
+	}
+	if e.toHost, rest, ok = cutHost(rest); !ok || strings.Contains(rest, ":") {
+		return e, invalid
+	}
+	e.toPort = rest
+	if e.port != "" && !validPort(e.port) || e.toPort != "" && !validPort(e.toPort) {
+		return e, invalid
+	}
+	return e, nil
+}
+
+// CheckResolve checks --resolve entries, which are otherwise only parsed
+// when a connection is made.
+func CheckResolve(entries []string) error {
+	for _, entry := range entries {
+		if _, err := parseResolve(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckConnectTo checks --connect-to entries like CheckResolve.
+func CheckConnectTo(entries []string) error {
+	for _, entry := range entries {
+		if _, err := parseConnectTo(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// connectTarget returns the address to connect to for the origin server at
+// addr, the first --connect-to entry that matches replaces it.
+func (c *Client) connectTarget(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range c.connectTo {
+		e, err := parseConnectTo(entry)
+		if err != nil {
+			return "", err
+		}
+		if (e.host != "" && e.host != strings.ToLower(host)) || (e.port != "" && e.port != port) {
+			continue
+		}
+		if e.toHost != "" {
+			host = e.toHost
+		}
+		if e.toPort != "" {
+			port = e.toPort
+		}
+		target := net.JoinHostPort(host, port)
+		c.infof("Connecting to %s instead of %s", target, addr)
+		return target, nil
+	}
+	return addr, nil
+}
+
+// resolveAddrs returns the addresses --resolve gives for addr, nil when no
+// entry matches. The last matching entry wins.
+func (c *Client) resolveAddrs(addr string) ([]string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	host = strings.ToLower(host)
+	var addrs []string
+	for _, entry := range c.resolve {
+		r, err := parseResolve(entry)
+		if err != nil {
+			return nil, err
+		}
+		if (r.host == host || r.host == "*") && r.port == port {
+			addrs = r.addrs // nil for removals
+		}
+	}
+	if addrs != nil {
+		c.infof("Resolved %s to %s from --resolve", addr, strings.Join(addrs, ", "))
+	}
+	return addrs, nil
+}
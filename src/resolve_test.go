@@ -0,0 +1,119 @@
+package src
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseResolveAndConnectTo(t *testing.T) {
+	resolves := map[string]resolveEntry{
+		"example.com:443:127.0.0.1":      {host: "example.com", port: "443", addrs: []string{"127.0.0.1:443"}},
+		"+Example.com:80:10.0.0.1,[::1]": {host: "example.com", port: "80", addrs: []string{"10.0.0.1:80", "[::1]:80"}},
+		"*:443:::1":                      {host: "*", port: "443", addrs: []string{"[::1]:443"}},
+		"[2001:db8::1]:443:127.0.0.1":    {host: "2001:db8::1", port: "443", addrs: []string{"127.0.0.1:443"}},
+		"-example.com:443":               {host: "example.com", port: "443", remove: true},
+	}
+	for entry, want := range resolves {
+		got, err := parseResolve(entry)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("parseResolve(%q) = %+v, %v, want %+v", entry, got, err, want)
+		}
+	}
+	for _, entry := range []string{"example.com", "example.com:443", ":443:127.0.0.1", "example.com:443:not-an-ip", "-example.com:443:127.0.0.1", "example.com:https:127.0.0.1"} {
+		if _, err := parseResolve(entry); err == nil {
+			t.Errorf("parseResolve(%q) should fail", entry)
+		}
+	}
+
+	connectTos := map[string]connectToEntry{
+		"example.com:443:backend:8443": {host: "example.com", port: "443", toHost: "backend", toPort: "8443"},
+		"::[::1]:":                     {toHost: "::1"},
+		"[::1]:80:example.com:":        {host: "::1", port: "80", toHost: "example.com"},
+	}
+	for entry, want := range connectTos {
+		got, err := parseConnectTo(entry)
+		if err != nil || got != want {
+			t.Errorf("parseConnectTo(%q) = %+v, %v, want %+v", entry, got, err, want)
+		}
+	}
+	for _, entry := range []string{"example.com:443", "example.com:443:backend", "a:1:b:2:3", "a:1:b:70000"} {
+		if _, err := parseConnectTo(entry); err == nil {
+			t.Errorf("parseConnectTo(%q) should fail", entry)
+		}
+	}
+
+	if err := CheckResolve([]string{"example.com:443:127.0.0.1", "example.com:443"}); err == nil {
+		t.Error("CheckResolve should report the invalid entry")
+	}
+	if err := CheckConnectTo([]string{"example.com:443:backend:8443"}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestResolveAndConnectToAllVersions(t *testing.T) {
+	serverCert, _, _ := writeTestCertificate(t, "server")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + " " + r.TLS.ServerName))
+	})
+	tcpURL, h3URL := newTestServers(t, &tls.Config{Certificates: []tls.Certificate{serverCert}}, handler)
+
+	ports := map[string]string{"1.1": tcpURL, "2": tcpURL, "3": h3URL}
+	for version, target := range ports {
+		_, port, _ := net.SplitHostPort(strings.TrimPrefix(target, "https://"))
+
+		// Nothing listens on the first address over TCP. QUIC only gives up
+		// on it at the timeout, so HTTP/3 gets just the working one
+		addrs := "127.0.0.2,127.0.0.1"
+		if version == "3" {
+			addrs = "127.0.0.1"
+		}
+		var verbose bytes.Buffer
+		resp, err := NewClient().SetHTTPVersion(version).SetInsecure(true).SetVerbose(&verbose).
+			SetResolve([]string{"new.example:" + port + ":" + addrs}).
+			Get("https://new.example:" + port)
+		if err != nil {
+			t.Fatalf("HTTP/%s with --resolve: %v", version, err)
+		}
+		if want := "new.example:" + port + " new.example"; string(resp.Body) != want {
+			t.Errorf("HTTP/%s with --resolve: Host and SNI are %q, want %q", version, resp.Body, want)
+		}
+		if !strings.Contains(verbose.String(), "* Resolved new.example:"+port+" to 127.0.0.") {
+			t.Errorf("HTTP/%s: verbose output doesn't show --resolve:\n%s", version, verbose.String())
+		}
+
+		verbose.Reset()
+		resp, err = NewClient().SetHTTPVersion(version).SetInsecure(true).SetVerbose(&verbose).
+			SetConnectTo([]string{"other.example:1:unused:2", "new.example::localhost:" + port}).
+			Get("https://new.example")
+		if err != nil {
+			t.Fatalf("HTTP/%s with --connect-to: %v", version, err)
+		}
+		if string(resp.Body) != "new.example new.example" {
+			t.Errorf("HTTP/%s with --connect-to: Host and SNI are %q", version, resp.Body)
+		}
+		if !strings.Contains(verbose.String(), "* Connecting to localhost:"+port+" instead of new.example:443\n") {
+			t.Errorf("HTTP/%s: verbose output doesn't show --connect-to:\n%s", version, verbose.String())
+		}
+	}
+
+	// --connect-to picks the target of the tunnel, --resolve resolves it for
+	// SOCKS versions that resolve locally
+	proxy := newSOCKSProxy(t)
+	defer proxy.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(tcpURL, "https://"))
+	_, err := NewClient().SetInsecure(true).SetProxy("socks5://user:pass@" + proxy.Addr().String()).
+		SetConnectTo([]string{"new.example:443:backend.example:" + port}).
+		SetResolve([]string{"backend.example:" + port + ":127.0.0.1"}).
+		Get("https://new.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := proxy.lastTarget(); got != "127.0.0.1:"+port {
+		t.Errorf("the SOCKS5 proxy was asked for %s", got)
+	}
+}
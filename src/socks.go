@@ -0,0 +1,473 @@
+package src
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	socks4Version = 0x04
+	socks5Version = 0x05
+
+	socksConnect      = 0x01
+	socksUDPAssociate = 0x03
+
+	socks5NoAuth       = 0x00
+	socks5UserPassword = 0x02
+	socks5NoAcceptable = 0xff
+
+	socks5IPv4   = 0x01
+	socks5Domain = 0x03
+	socks5IPv6   = 0x04
+)
+
+var (
+	ErrSOCKSAuth = errors.New("SOCKS proxy rejected the credentials")
+	ErrSOCKSUDP  = errors.New("SOCKS4 proxies can't carry HTTP/3, use a SOCKS5 proxy")
+
+	socks5Errors = map[byte]string{
+		0x01: "general failure",
+		0x02: "connection not allowed by ruleset",
+		0x03: "network unreachable",
+		0x04: "host unreachable",
+		0x05: "connection refused",
+		0x06: "TTL expired",
+		0x07: "command not supported",
+		0x08: "address type not supported",
+	}
+)
+
+// isSOCKS reports whether the proxy scheme is one of the SOCKS versions.
+func isSOCKS(scheme string) bool {
+	switch scheme {
+	case "socks4", "socks4a", "socks5", "socks5h":
+		return true
+	}
+	return false
+}
+
+// socksRemoteResolve reports whether the proxy resolves host names, which is
+// the case for socks4a and socks5h.
+func socksRemoteResolve(scheme string) bool {
+	return scheme == "socks4a" || scheme == "socks5h"
+}
+
+// dialSOCKS connects to addr through a SOCKS proxy. When the client resolves
+// the name, the addresses are tried in turn while the proxy reports them
+// unreachable.
+func (c *Client) dialSOCKS(proxyURL *url.URL, addr string) (net.Conn, error) {
+	targets, err := c.socksTargets(proxyURL, addr)
+	if err != nil {
+		return nil, err
+	}
+	var firstErr error
+	for i, target := range targets {
+		conn, err := c.socksConnect(proxyURL, target)
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		var reply *socksReplyError
+		if i == len(targets)-1 || !errors.As(err, &reply) || !reply.unreachable {
+			break
+		}
+		c.infof("%v, trying the next address", err)
+	}
+	return nil, firstErr
+}
+
+// socksConnect opens a tunnel to addr through a new connection to the proxy.
+func (c *Client) socksConnect(proxyURL *url.URL, addr string) (net.Conn, error) {
+	conn, err := c.dialProxyHost(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	if c.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+
+	if proxyURL.Scheme == "socks4" || proxyURL.Scheme == "socks4a" {
+		err = c.socks4Connect(conn, proxyURL, addr)
+	} else {
+		_, err = c.socks5Request(conn, proxyURL, socksConnect, addr)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s proxy %s: %w", proxyURL.Scheme, proxyURL.Host, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// socksTargets resolves the host of addr for the SOCKS versions that don't
+// let the proxy do it, keeping the resolver's order and address family.
+// SOCKS4 only carries IPv4 addresses.
+func (c *Client) socksTargets(proxyURL *url.URL, addr string) ([]string, error) {
+	if socksRemoteResolve(proxyURL.Scheme) {
+		return []string{addr}, nil
+	}
+	addrs, err := c.lookupAddrs(addr)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL.Scheme != "socks4" {
+		return addrs, nil
+	}
+	var ipv4 []string
+	for _, a := range addrs {
+		if host, _, _ := net.SplitHostPort(a); net.ParseIP(host).To4() != nil {
+			ipv4 = append(ipv4, a)
+		}
+	}
+	if len(ipv4) == 0 {
+		return nil, fmt.Errorf("socks4 needs an IPv4 address for %s", addr)
+	}
+	return ipv4, nil
+}
+
+func splitHostPortNumber(addr string) (string, uint16, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port in %s", addr)
+	}
+	return host, uint16(port), nil
+}
+
+// socks4Connect performs a SOCKS4 or SOCKS4a CONNECT.
+func (c *Client) socks4Connect(conn net.Conn, proxyURL *url.URL, addr string) error {
+	host, port, err := splitHostPortNumber(addr)
+	if err != nil {
+		return err
+	}
+	_, username, _ := c.proxyCredentials(proxyURL)
+
+	req := []byte{socks4Version, socksConnect, 0, 0}
+	binary.BigEndian.PutUint16(req[2:], port)
+	ip := net.ParseIP(host).To4()
+	if ip == nil {
+		// SOCKS4a: an invalid address tells the proxy to resolve the name
+		req = append(req, 0, 0, 0, 1)
+		req = append(req, username...)
+		req = append(req, 0)
+		req = append(req, host...)
+		req = append(req, 0)
+	} else {
+		req = append(req, ip...)
+		req = append(req, username...)
+		req = append(req, 0)
+	}
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	resp := make([]byte, 8)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return err
+	}
+	switch resp[1] {
+	case 0x5a:
+	case 0x5b:
+		// rejected or failed, which is all SOCKS4 says about the target
+		return &socksReplyError{msg: "request rejected or failed", unreachable: true}
+	default:
+		return &socksReplyError{msg: fmt.Sprintf("request rejected (code %d)", resp[1])}
+	}
+	return nil
+}
+
+// socks5Request authenticates and sends a SOCKS5 command, returning the bound
+// address of the reply.
+func (c *Client) socks5Request(conn net.Conn, proxyURL *url.URL, command byte, addr string) (*net.UDPAddr, error) {
+	_, username, password := c.proxyCredentials(proxyURL)
+	// Every field is sent with a length byte, check them before writing
+	if len(username) > 255 || len(password) > 255 {
+		return nil, errors.New("user name and password must be at most 255 bytes each")
+	}
+	target, err := socks5Address(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	methods := []byte{socks5NoAuth}
+	if username != "" {
+		methods = append(methods, socks5UserPassword)
+	}
+	greeting := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return nil, err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, err
+	}
+	switch reply[1] {
+	case socks5NoAuth:
+	case socks5UserPassword:
+		// RFC 1929
+		auth := []byte{0x01, byte(len(username))}
+		auth = append(auth, username...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err := conn.Write(auth); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return nil, err
+		}
+		if reply[1] != 0 {
+			return nil, ErrSOCKSAuth
+		}
+	case socks5NoAcceptable:
+		return nil, ErrSOCKSAuth
+	default:
+		return nil, fmt.Errorf("unsupported authentication method %d", reply[1])
+	}
+
+	req := append([]byte{socks5Version, command, 0}, target...)
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	if header[1] != 0 {
+		msg, ok := socks5Errors[header[1]]
+		if !ok {
+			msg = fmt.Sprintf("request failed (code %d)", header[1])
+		}
+		// network or host unreachable, connection refused
+		unreachable := header[1] >= 0x03 && header[1] <= 0x05
+		return nil, &socksReplyError{msg: msg, unreachable: unreachable}
+	}
+	bound, err := readSOCKS5Address(conn, header[3])
+	if err != nil {
+		return nil, err
+	}
+	return bound, nil
+}
+
+// socksReplyError is a request the proxy answered with a failure.
+// unreachable tells the target couldn't be reached, so another address of
+// the same host may work.
+type socksReplyError struct {
+	msg         string
+	unreachable bool
+}
+
+func (e *socksReplyError) Error() string { return e.msg }
+
+// socks5Address encodes addr as SOCKS5 ATYP, address and port. Host names
+// are left for the proxy to resolve.
+func socks5Address(addr string) ([]byte, error) {
+	host, port, err := splitHostPortNumber(addr)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(host)
+
+	var b []byte
+	switch {
+	case ip == nil:
+		if len(host) > 255 {
+			return nil, fmt.Errorf("host name too long: %s", host)
+		}
+		b = append([]byte{socks5Domain, byte(len(host))}, host...)
+	case ip.To4() != nil:
+		b = append([]byte{socks5IPv4}, ip.To4()...)
+	default:
+		b = append([]byte{socks5IPv6}, ip.To16()...)
+	}
+	return binary.BigEndian.AppendUint16(b, port), nil
+}
+
+// readSOCKS5Address reads an address of the given type followed by a port.
+func readSOCKS5Address(r io.Reader, atyp byte) (*net.UDPAddr, error) {
+	var ip []byte
+	switch atyp {
+	case socks5IPv4:
+		ip = make([]byte, net.IPv4len)
+	case socks5IPv6:
+		ip = make([]byte, net.IPv6len)
+	case socks5Domain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(r, length); err != nil {
+			return nil, err
+		}
+		// A bound domain name can't be used, skip it
+		if _, err := io.ReadFull(r, make([]byte, length[0])); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown address type %d", atyp)
+	}
+	if _, err := io.ReadFull(r, ip); err != nil {
+		return nil, err
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return nil, err
+	}
+	return &net.UDPAddr{IP: ip, Port: int(binary.BigEndian.Uint16(port))}, nil
+}
+
+// socksAddr is a target address the proxy resolves, used with socks5h.
+type socksAddr string
+
+func (a socksAddr) Network() string { return "udp" }
+func (a socksAddr) String() string  { return string(a) }
+
+// socksPacketConn relays datagrams through a SOCKS5 UDP association. The
+// control connection has to stay open as long as the association is used.
+// The UDP socket is embedded as a plain net.PacketConn so QUIC can't bypass
+// the encapsulation through the extended *net.UDPConn methods.
+type socksPacketConn struct {
+	net.PacketConn
+	ctrl   net.Conn
+	relay  *net.UDPAddr
+	target net.Addr
+}
+
+// listenSOCKS5UDP asks the proxy for a UDP association used to reach target.
+func (c *Client) listenSOCKS5UDP(proxyURL *url.URL, target string) (*socksPacketConn, net.Addr, error) {
+	if proxyURL.Scheme == "socks4" || proxyURL.Scheme == "socks4a" {
+		return nil, nil, ErrSOCKSUDP
+	}
+	// UDP gets no reply about the target, the first address is used
+	targets, err := c.socksTargets(proxyURL, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	target = targets[0]
+	ctrl, err := c.dialProxyHost(proxyURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.timeout > 0 {
+		ctrl.SetDeadline(time.Now().Add(c.timeout))
+	}
+	relay, err := c.socks5Request(ctrl, proxyURL, socksUDPAssociate, "0.0.0.0:0")
+	if err != nil {
+		ctrl.Close()
+		return nil, nil, fmt.Errorf("%s proxy %s: %w", proxyURL.Scheme, proxyURL.Host, err)
+	}
+	ctrl.SetDeadline(time.Time{})
+	if relay.IP == nil || relay.IP.IsUnspecified() {
+		// the relay listens on the proxy address, or a name, which
+		// readSOCKS5Address leaves nil
+		relay.IP = ctrl.RemoteAddr().(*net.TCPAddr).IP
+	}
+
+	var targetAddr net.Addr = socksAddr(target)
+	if !socksRemoteResolve(proxyURL.Scheme) {
+		if targetAddr, err = net.ResolveUDPAddr("udp", target); err != nil {
+			ctrl.Close()
+			return nil, nil, err
+		}
+	}
+	udp, err := c.listenPacket(context.Background(), relay.String())
+	if err != nil {
+		ctrl.Close()
+		return nil, nil, err
+	}
+	return &socksPacketConn{
+		PacketConn: udp,
+		ctrl:       ctrl,
+		relay:      relay,
+		target:     targetAddr,
+	}, targetAddr, nil
+}
+
+// dialSOCKSQUIC is the HTTP/3 dialer that sends QUIC through the UDP
+// association of a SOCKS5 proxy.
+func (c *Client) dialSOCKSQUIC(ctx context.Context, proxyURL *url.URL, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+	pc, target, err := c.listenSOCKS5UDP(proxyURL, addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := quic.DialEarly(ctx, pc, target, tlsCfg, cfg)
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+	context.AfterFunc(conn.Context(), func() { pc.Close() })
+	return conn, nil
+}
+
+func (p *socksPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	target, err := socks5Address(addr.String())
+	if err != nil {
+		return 0, err
+	}
+	datagram := append(append([]byte{0, 0, 0}, target...), b...)
+	if _, err := p.PacketConn.WriteTo(datagram, p.relay); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (p *socksPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	buf := make([]byte, len(b)+262)
+	for {
+		n, _, err := p.PacketConn.ReadFrom(buf)
+		if err != nil {
+			return 0, nil, err
+		}
+		if n < 4 || buf[2] != 0 {
+			// too short or fragmented, drop it
+			continue
+		}
+		r := &sliceReader{b: buf[4:n]}
+		if _, err := readSOCKS5Address(r, buf[3]); err != nil {
+			continue
+		}
+		// The association only talks to one peer, report it the way it
+		// was dialed so socks5h names stay intact.
+		return copy(b, r.b), p.target, nil
+	}
+}
+
+// SetReadBuffer and SetWriteBuffer let QUIC size the socket buffers.
+func (p *socksPacketConn) SetReadBuffer(bytes int) error {
+	return p.PacketConn.(*net.UDPConn).SetReadBuffer(bytes)
+}
+
+func (p *socksPacketConn) SetWriteBuffer(bytes int) error {
+	return p.PacketConn.(*net.UDPConn).SetWriteBuffer(bytes)
+}
+
+func (p *socksPacketConn) Close() error {
+	p.ctrl.Close()
+	return p.PacketConn.Close()
+}
+
+// sliceReader reads from a byte slice and keeps the remainder.
+type sliceReader struct {
+	b []byte
+}
+
+func (r *sliceReader) Read(p []byte) (int, error) {
+	if len(r.b) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.b)
+	r.b = r.b[n:]
+	return n, nil
+}
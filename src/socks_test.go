@@ -0,0 +1,376 @@
+package src
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// socksProxy is a SOCKS4/4a/5 stand-in. SOCKS5 requires user:pass and
+// supports CONNECT and UDP ASSOCIATE. It records the targets it was asked
+// for so the tests can tell where names were resolved.
+type socksProxy struct {
+	net.Listener
+	mu        sync.Mutex
+	targets   []string
+	boundName string // UDP ASSOCIATE replies with this name instead of the relay address
+}
+
+func newSOCKSProxy(t *testing.T) *socksProxy {
+	return newSOCKSProxyOn(t, "127.0.0.1")
+}
+
+// newSOCKSProxyOn starts a proxy whose UDP relays listen on ip too.
+func newSOCKSProxyOn(t *testing.T, ip string) *socksProxy {
+	l, err := net.Listen("tcp", net.JoinHostPort(ip, "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &socksProxy{Listener: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go p.serve(conn)
+		}
+	}()
+	return p
+}
+
+func (p *socksProxy) record(target string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.targets = append(p.targets, target)
+}
+
+func (p *socksProxy) lastTarget() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.targets) == 0 {
+		return ""
+	}
+	return p.targets[len(p.targets)-1]
+}
+
+func (p *socksProxy) serve(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	version, err := br.ReadByte()
+	if err != nil {
+		return
+	}
+	if version == socks4Version {
+		p.serveSOCKS4(conn, br)
+		return
+	}
+
+	// greeting, only user:pass is accepted
+	methods := make([]byte, 1)
+	io.ReadFull(br, methods)
+	io.ReadFull(br, make([]byte, methods[0]))
+	conn.Write([]byte{socks5Version, socks5UserPassword})
+	auth := make([]byte, 2)
+	io.ReadFull(br, auth)
+	username := make([]byte, auth[1])
+	io.ReadFull(br, username)
+	length, _ := br.ReadByte()
+	password := make([]byte, length)
+	io.ReadFull(br, password)
+	if string(username) != "user" || string(password) != "pass" {
+		conn.Write([]byte{0x01, 0x01})
+		return
+	}
+	conn.Write([]byte{0x01, 0x00})
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return
+	}
+	var host string
+	switch header[3] {
+	case socks5Domain:
+		length, _ := br.ReadByte()
+		name := make([]byte, length)
+		io.ReadFull(br, name)
+		host = string(name)
+	case socks5IPv4:
+		ip := make([]byte, net.IPv4len)
+		io.ReadFull(br, ip)
+		host = net.IP(ip).String()
+	case socks5IPv6:
+		ip := make([]byte, net.IPv6len)
+		io.ReadFull(br, ip)
+		host = net.IP(ip).String()
+	}
+	port := make([]byte, 2)
+	io.ReadFull(br, port)
+
+	if header[1] == socksUDPAssociate {
+		p.serveUDP(conn)
+		return
+	}
+	target := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	p.record(target)
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		conn.Write([]byte{socks5Version, 0x05, 0, socks5IPv4, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	conn.Write([]byte{socks5Version, 0, 0, socks5IPv4, 0, 0, 0, 0, 0, 0})
+	go io.Copy(upstream, br)
+	io.Copy(conn, upstream)
+}
+
+func (p *socksProxy) serveSOCKS4(conn net.Conn, br *bufio.Reader) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return
+	}
+	if _, err := br.ReadString(0); err != nil { // user id
+		return
+	}
+	host := net.IP(header[3:7]).String()
+	if header[3] == 0 && header[4] == 0 && header[5] == 0 {
+		name, err := br.ReadString(0)
+		if err != nil {
+			return
+		}
+		host = name[:len(name)-1]
+	}
+	target := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(header[1:3]))))
+	p.record(target)
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		conn.Write([]byte{0, 0x5b, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	conn.Write([]byte{0, 0x5a, 0, 0, 0, 0, 0, 0})
+	go io.Copy(upstream, br)
+	io.Copy(conn, upstream)
+}
+
+// serveUDP relays datagrams for the client until the control connection
+// closes.
+func (p *socksProxy) serveUDP(ctrl net.Conn) {
+	relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: ctrl.LocalAddr().(*net.TCPAddr).IP})
+	if err != nil {
+		return
+	}
+	defer relay.Close()
+	bound := relay.LocalAddr().(*net.UDPAddr)
+	reply := append([]byte{socks5Version, 0, 0, socks5IPv4}, bound.IP.To4()...)
+	if p.boundName != "" {
+		reply = append([]byte{socks5Version, 0, 0, socks5Domain, byte(len(p.boundName))}, p.boundName...)
+	}
+	ctrl.Write(binary.BigEndian.AppendUint16(reply, uint16(bound.Port)))
+
+	go func() {
+		var client, target *net.UDPAddr
+		buf := make([]byte, 65535)
+		for {
+			n, from, err := relay.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if client == nil || from.String() == client.String() {
+				client = from
+				r := &sliceReader{b: buf[4:n]}
+				if buf[3] == socks5Domain {
+					name := string(buf[5 : 5+buf[4]])
+					port := binary.BigEndian.Uint16(buf[5+buf[4]:])
+					r.b = buf[7+buf[4] : n]
+					addr := net.JoinHostPort(name, strconv.Itoa(int(port)))
+					if target, err = net.ResolveUDPAddr("udp4", addr); err != nil {
+						continue
+					}
+					p.record(addr)
+				} else {
+					if target, err = readSOCKS5Address(r, buf[3]); err != nil {
+						continue
+					}
+					p.record(target.String())
+				}
+				relay.WriteToUDP(r.b, target)
+				continue
+			}
+			datagram := append([]byte{0, 0, 0, socks5IPv4}, from.IP.To4()...)
+			datagram = binary.BigEndian.AppendUint16(datagram, uint16(from.Port))
+			relay.WriteToUDP(append(datagram, buf[:n]...), client)
+		}
+	}()
+	io.Copy(io.Discard, ctrl)
+}
+
+func TestSOCKSProxy(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	proxy := newSOCKSProxy(t)
+	defer proxy.Close()
+
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	target := "http://localhost:" + port
+	tests := []struct {
+		proxy      string
+		remoteName bool
+	}{
+		{"socks4://" + proxy.Addr().String(), false},
+		{"socks4a://" + proxy.Addr().String(), true},
+		{"socks5://user:pass@" + proxy.Addr().String(), false},
+		{"socks5h://user:pass@" + proxy.Addr().String(), true},
+	}
+	for _, test := range tests {
+		resp, err := NewClient().SetProxy(test.proxy).Get(target)
+		if err != nil {
+			t.Fatalf("request through %s failed: %v", test.proxy, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("request through %s: %d", test.proxy, resp.StatusCode)
+		}
+		if got := proxy.lastTarget() == "localhost:"+port; got != test.remoteName {
+			t.Errorf("%s asked the proxy for %s", test.proxy, proxy.lastTarget())
+		}
+	}
+
+	// --proxy-user is used for SOCKS5 as well
+	_, err := NewClient().SetProxy("socks5://" + proxy.Addr().String()).
+		SetProxyBasicAuth("user:wrong").Get(target)
+	if !errors.Is(err, ErrSOCKSAuth) {
+		t.Errorf("wrong SOCKS5 password should fail with ErrSOCKSAuth, got %v", err)
+	}
+
+	// Fields longer than their length byte fail before anything is sent
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	received := make(chan int, 1)
+	go func() {
+		conn, err := silent.Accept()
+		if err != nil {
+			return
+		}
+		n, _ := io.Copy(io.Discard, conn)
+		received <- int(n)
+	}()
+	long := strings.Repeat("a", 256)
+	if _, err := NewClient().SetProxy("socks5://" + silent.Addr().String()).
+		SetProxyBasicAuth("user:" + long).Get(target); err == nil {
+		t.Error("a password over 255 bytes should fail")
+	}
+	if n := <-received; n != 0 {
+		t.Errorf("%d bytes were sent to the proxy", n)
+	}
+	if _, err := NewClient().SetProxy("socks5h://user:pass@" + proxy.Addr().String()).
+		Get("http://" + long + ".example:" + port); err == nil {
+		t.Error("a host name over 255 bytes should fail")
+	}
+}
+
+func TestSOCKSProxyNextAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	defer server.Close()
+	proxy := newSOCKSProxy(t)
+	defer proxy.Close()
+
+	// Nothing listens on 127.0.0.2, the proxy reports it unreachable
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	resolve := []string{"next.example:" + port + ":127.0.0.2,127.0.0.1"}
+	for _, scheme := range []string{"socks4://", "socks5://user:pass@"} {
+		resp, err := NewClient().SetProxy(scheme + proxy.Addr().String()).
+			SetResolve(resolve).Get("http://next.example:" + port)
+		if err != nil {
+			t.Fatalf("request through %s failed: %v", scheme, err)
+		}
+		if resp.StatusCode != http.StatusOK || proxy.lastTarget() != server.Listener.Addr().String() {
+			t.Errorf("%s: %d via %s", scheme, resp.StatusCode, proxy.lastTarget())
+		}
+	}
+}
+
+func TestSOCKSProxyHTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	proxy := newSOCKSProxy(t)
+	defer proxy.Close()
+
+	resp, err := NewClient().SetHTTPVersion("2").SetInsecure(true).
+		SetProxy("socks5h://user:pass@" + proxy.Addr().String()).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.Body) != "HTTP/2.0" || proxy.lastTarget() != server.Listener.Addr().String() {
+		t.Errorf("HTTP/2 through SOCKS5: %s via %s", resp.Body, proxy.lastTarget())
+	}
+}
+
+func TestSOCKSProxyHTTP3(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsServer.Close()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	server := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: tlsServer.TLS.Certificates}),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto))
+		}),
+	}
+	go server.Serve(udp)
+	defer server.Close()
+	proxy := newSOCKSProxy(t)
+	defer proxy.Close()
+
+	_, port, _ := net.SplitHostPort(udp.LocalAddr().String())
+	resp, err := NewClient().SetHTTPVersion("3").SetInsecure(true).
+		SetProxy("socks5h://user:pass@" + proxy.Addr().String()).Get("https://localhost:" + port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.Body) != "HTTP/3.0" || proxy.lastTarget() != "localhost:"+port {
+		t.Errorf("HTTP/3 through SOCKS5: %s via %s", resp.Body, proxy.lastTarget())
+	}
+
+	// A relay bound to a name is reached at the proxy address, not the
+	// local host
+	named := newSOCKSProxyOn(t, "127.0.0.2")
+	defer named.Close()
+	named.boundName = "relay.invalid"
+	resp, err = NewClient().SetHTTP3Only(true).SetInsecure(true).
+		SetProxy("socks5h://user:pass@" + named.Addr().String()).Get("https://localhost:" + port)
+	if err != nil || string(resp.Body) != "HTTP/3.0" {
+		t.Errorf("HTTP/3 through a relay bound to a name: %v, %v", resp, err)
+	}
+
+	_, err = NewClient().SetHTTPVersion("3").SetInsecure(true).
+		SetProxy("socks4://" + proxy.Addr().String()).Get("https://localhost:" + port)
+	if !errors.Is(err, ErrSOCKSUDP) {
+		t.Errorf("HTTP/3 through SOCKS4 should fail with ErrSOCKSUDP, got %v", err)
+	}
+}
@@ -0,0 +1,630 @@
+package src
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+var (
+	ErrPinnedPubKey      = errors.New("server public key doesn't match the pinned public key")
+	ErrOCSPStapleMissing = errors.New("server didn't staple an OCSP response")
+)
+
+// CertificateError is returned when a server certificate can't be verified.
+// It names the certificate that failed and says why.
+type CertificateError struct {
+	Subject string // subject of the failing certificate
+	Reason  string
+	Err     error // the underlying x509 error, if any
+}
+
+func (e *CertificateError) Error() string {
+	return fmt.Sprintf("certificate %q %s", e.Subject, e.Reason)
+}
+
+func (e *CertificateError) Unwrap() error {
+	return e.Err
+}
+
+// policyError is a --pinnedpubkey or --cert-status failure, which are
+// checked even when verifying the chain is skipped.
+type policyError struct{ err error }
+
+func (e *policyError) Error() string { return e.err.Error() }
+func (e *policyError) Unwrap() error { return e.err }
+
+// tlsOptions are the TLS settings of one hop, the origin or the proxy.
+// Files are read when a connection is made so their errors reach the
+// request instead of being lost in a setter.
+type tlsOptions struct {
+	insecure     bool
+	caFile       string // PEM bundle replacing the system roots
+	caPath       string // directory of PEM certificates, like OpenSSL's hashed dirs
+	crlFile      string // PEM or DER revocation lists
+	cert         clientCert
+	pinnedPubKey string // file or sha256//base64 hashes separated by ';'
+	minVersion   uint16
+	maxVersion   uint16
+	ciphers      string // TLS 1.2 and below, OpenSSL or IANA names separated by ':' or ','
+	tls13Ciphers string
+	curves       string
+	noALPN       bool
+	certStatus   bool   // require a good stapled OCSP response
+	keyLogFile   string // NSS key log, $SSLKEYLOGFILE when empty
+
+	sessions tls.ClientSessionCache // shared by the connections of a Client
+}
+
+// config builds the tls.Config for a connection to serverName. It is the one
+// place TLS is set up, for every HTTP version and for proxies. Certificates
+// are verified by VerifyConnection rather than crypto/tls, so the errors can
+// say which certificate failed and CRLs can be checked. infof receives the
+// verbose output of the handshake.
+func (o *tlsOptions) config(serverName string, infof func(format string, args ...interface{})) (*tls.Config, error) {
+	if o.sessions == nil {
+		o.sessions = tls.NewLRUClientSessionCache(0)
+	}
+	cfg := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+		MinVersion:         o.minVersion,
+		MaxVersion:         o.maxVersion,
+		ClientSessionCache: o.sessions,
+	}
+	keyLog := o.keyLogFile
+	if keyLog == "" {
+		keyLog = os.Getenv("SSLKEYLOGFILE")
+	}
+	if keyLog != "" {
+		cfg.KeyLogWriter = keyLogFile(keyLog)
+	}
+	if o.minVersion != 0 && o.maxVersion != 0 && o.minVersion > o.maxVersion {
+		return nil, fmt.Errorf("minimum TLS version %s is above the maximum %s",
+			tls.VersionName(o.minVersion), tls.VersionName(o.maxVersion))
+	}
+
+	var err error
+	if cfg.CipherSuites, err = parseCiphers(o.ciphers); err != nil {
+		return nil, err
+	}
+	if err := checkTLS13Ciphers(o.tls13Ciphers); err != nil {
+		return nil, err
+	}
+	if cfg.CurvePreferences, err = parseCurves(o.curves); err != nil {
+		return nil, err
+	}
+
+	roots, err := o.rootCAs()
+	if err != nil {
+		return nil, err
+	}
+	cfg.RootCAs = roots
+	var crls []*x509.RevocationList
+	if o.crlFile != "" {
+		if crls, err = loadCRLs(o.crlFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.cert.certFile != "" {
+		cert, err := o.cert.load()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	var pins [][]byte
+	if o.pinnedPubKey != "" {
+		if pins, err = parsePinnedPubKey(o.pinnedPubKey); err != nil {
+			return nil, err
+		}
+	}
+
+	insecure, certStatus := o.insecure, o.certStatus
+	cfg.VerifyConnection = func(state tls.ConnectionState) error {
+		logHandshake(state, serverName, infof)
+		chain := state.PeerCertificates
+		if !insecure {
+			host := serverName
+			if host == "" {
+				host = state.ServerName
+			}
+			var err error
+			if chain, err = verifyCertificate(state.PeerCertificates, roots, crls, host); err != nil {
+				return err
+			}
+		}
+		if certStatus {
+			if err := verifyOCSPStaple(state.OCSPResponse, chain, infof); err != nil {
+				return &policyError{err}
+			}
+		}
+		if pins != nil {
+			if err := verifyPinnedPubKey(pins, state); err != nil {
+				return &policyError{err}
+			}
+		}
+		return nil
+	}
+	return cfg, nil
+}
+
+// keyLogFile appends TLS secrets in the NSS key log format, for tools like
+// Wireshark. The file is opened for each line so nothing is left open.
+type keyLogFile string
+
+func (f keyLogFile) Write(p []byte) (int, error) {
+	file, err := os.OpenFile(string(f), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	n, err := file.Write(p)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
+
+// logHandshake writes the negotiated parameters and the certificate chain
+// of a handshake to the verbose output.
+func logHandshake(state tls.ConnectionState, serverName string, infof func(format string, args ...interface{})) {
+	alpn := "no ALPN"
+	if state.NegotiatedProtocol != "" {
+		alpn = "ALPN " + state.NegotiatedProtocol
+	}
+	session := "new session"
+	if state.DidResume {
+		session = "resumed session"
+	}
+	infof("%s connection to %s using %s, %s, %s", tls.VersionName(state.Version), serverName,
+		tls.CipherSuiteName(state.CipherSuite), alpn, session)
+	infof("Server certificate chain:")
+	for i, cert := range state.PeerCertificates {
+		infof("%2d subject: %s", i, cert.Subject)
+		infof("   issuer: %s", cert.Issuer)
+		if sans := certificateSANs(cert); len(sans) > 0 {
+			infof("   SANs: %s", strings.Join(sans, ", "))
+		}
+		infof("   expires: %s", cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+}
+
+// certificateSANs lists the subject alternative names of cert.
+func certificateSANs(cert *x509.Certificate) []string {
+	sans := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
+
+// checkHTTPVersion fails when the options can't be honored by the transport
+// of the HTTP version, before anything is sent.
+func (o *tlsOptions) checkHTTPVersion(version string) error {
+	var minimum uint16
+	switch version {
+	case "2":
+		minimum = tls.VersionTLS12
+	case "3":
+		minimum = tls.VersionTLS13
+		if o.ciphers != "" {
+			return errors.New("HTTP/3 always uses TLS 1.3, the TLS 1.2 cipher list doesn't apply to it")
+		}
+	default:
+		return nil
+	}
+	if o.maxVersion != 0 && o.maxVersion < minimum {
+		return fmt.Errorf("HTTP/%s needs %s or later, but the maximum TLS version is %s",
+			version, tls.VersionName(minimum), tls.VersionName(o.maxVersion))
+	}
+	if o.noALPN {
+		return fmt.Errorf("HTTP/%s over TLS is negotiated with ALPN and can't be used without it", version)
+	}
+	return nil
+}
+
+// openSSLCiphers maps OpenSSL cipher names to the IANA names crypto/tls uses.
+var openSSLCiphers = map[string]string{
+	"RC4-SHA":                       "TLS_RSA_WITH_RC4_128_SHA",
+	"DES-CBC3-SHA":                  "TLS_RSA_WITH_3DES_EDE_CBC_SHA",
+	"AES128-SHA":                    "TLS_RSA_WITH_AES_128_CBC_SHA",
+	"AES256-SHA":                    "TLS_RSA_WITH_AES_256_CBC_SHA",
+	"AES128-SHA256":                 "TLS_RSA_WITH_AES_128_CBC_SHA256",
+	"AES128-GCM-SHA256":             "TLS_RSA_WITH_AES_128_GCM_SHA256",
+	"AES256-GCM-SHA384":             "TLS_RSA_WITH_AES_256_GCM_SHA384",
+	"ECDHE-ECDSA-RC4-SHA":           "TLS_ECDHE_ECDSA_WITH_RC4_128_SHA",
+	"ECDHE-ECDSA-AES128-SHA":        "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA",
+	"ECDHE-ECDSA-AES256-SHA":        "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA",
+	"ECDHE-RSA-RC4-SHA":             "TLS_ECDHE_RSA_WITH_RC4_128_SHA",
+	"ECDHE-RSA-DES-CBC3-SHA":        "TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA",
+	"ECDHE-RSA-AES128-SHA":          "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA",
+	"ECDHE-RSA-AES256-SHA":          "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA",
+	"ECDHE-ECDSA-AES128-SHA256":     "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256",
+	"ECDHE-RSA-AES128-SHA256":       "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256",
+	"ECDHE-RSA-AES128-GCM-SHA256":   "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	"ECDHE-ECDSA-AES128-GCM-SHA256": "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	"ECDHE-RSA-AES256-GCM-SHA384":   "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	"ECDHE-ECDSA-AES256-GCM-SHA384": "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	"ECDHE-RSA-CHACHA20-POLY1305":   "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+	"ECDHE-ECDSA-CHACHA20-POLY1305": "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+}
+
+// splitTLSList splits a cipher or curve list, separated by ':' like OpenSSL
+// or by ','.
+func splitTLSList(list string) []string {
+	return strings.FieldsFunc(list, func(r rune) bool {
+		return r == ':' || r == ',' || r == ' '
+	})
+}
+
+// parseCiphers returns the TLS 1.2 and below cipher suites of list, nil
+// for the defaults. Insecure suites are allowed, to test servers rejecting
+// them.
+func parseCiphers(list string) ([]uint16, error) {
+	if list == "" {
+		return nil, nil
+	}
+	suites := map[string]*tls.CipherSuite{}
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		suites[suite.Name] = suite
+	}
+	var ids []uint16
+	for _, name := range splitTLSList(list) {
+		iana := name
+		if mapped, ok := openSSLCiphers[strings.ToUpper(name)]; ok {
+			iana = mapped
+		}
+		suite, ok := suites[strings.ToUpper(iana)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or unsupported cipher %q", name)
+		}
+		if len(suite.SupportedVersions) == 1 && suite.SupportedVersions[0] == tls.VersionTLS13 {
+			return nil, fmt.Errorf("%s is a TLS 1.3 cipher suite, use the TLS 1.3 cipher list for it", name)
+		}
+		ids = append(ids, suite.ID)
+	}
+	return ids, nil
+}
+
+// checkTLS13Ciphers validates a TLS 1.3 cipher suite list. crypto/tls always
+// offers every TLS 1.3 suite, so a list leaving some out can't be honored.
+func checkTLS13Ciphers(list string) error {
+	if list == "" {
+		return nil
+	}
+	var all []string
+	listed := map[string]bool{}
+	for _, suite := range tls.CipherSuites() {
+		if len(suite.SupportedVersions) == 1 && suite.SupportedVersions[0] == tls.VersionTLS13 {
+			all = append(all, suite.Name)
+			listed[suite.Name] = false
+		}
+	}
+	for _, name := range splitTLSList(list) {
+		if _, ok := listed[strings.ToUpper(name)]; !ok {
+			return fmt.Errorf("unknown TLS 1.3 cipher suite %q", name)
+		}
+		listed[strings.ToUpper(name)] = true
+	}
+	for _, name := range all {
+		if !listed[name] {
+			return fmt.Errorf("TLS 1.3 cipher suites can't be restricted, %s is always offered", name)
+		}
+	}
+	return nil
+}
+
+// tlsCurves maps OpenSSL and RFC names of key exchange groups to their ids.
+var tlsCurves = map[string]tls.CurveID{
+	"x25519":         tls.X25519,
+	"p-256":          tls.CurveP256,
+	"prime256v1":     tls.CurveP256,
+	"secp256r1":      tls.CurveP256,
+	"p-384":          tls.CurveP384,
+	"secp384r1":      tls.CurveP384,
+	"p-521":          tls.CurveP521,
+	"secp521r1":      tls.CurveP521,
+	"x25519mlkem768": tls.X25519MLKEM768,
+}
+
+// parseCurves returns the key exchange groups of list, nil for the defaults.
+func parseCurves(list string) ([]tls.CurveID, error) {
+	var curves []tls.CurveID
+	for _, name := range splitTLSList(list) {
+		curve, ok := tlsCurves[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or unsupported curve %q", name)
+		}
+		curves = append(curves, curve)
+	}
+	return curves, nil
+}
+
+// rootCAs returns the pool of --cacert and --capath, or nil for the system
+// roots.
+func (o *tlsOptions) rootCAs() (*x509.CertPool, error) {
+	if o.caFile == "" && o.caPath == "" {
+		return nil, nil
+	}
+	pool := x509.NewCertPool()
+	if o.caFile != "" {
+		pemData, err := os.ReadFile(o.caFile)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("no certificates found in %s", o.caFile)
+		}
+	}
+	if o.caPath != "" {
+		entries, err := os.ReadDir(o.caPath)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			// Files that aren't certificates, like CRLs or READMEs, are skipped
+			pemData, err := os.ReadFile(filepath.Join(o.caPath, entry.Name()))
+			if err == nil && pool.AppendCertsFromPEM(pemData) {
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no certificates found in %s", o.caPath)
+		}
+	}
+	return pool, nil
+}
+
+// loadCRLs reads the revocation lists of a PEM file, or a single DER one.
+func loadCRLs(file string) ([]*x509.RevocationList, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var ders [][]byte
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "X509 CRL" {
+			ders = append(ders, block.Bytes)
+		}
+	}
+	if len(ders) == 0 {
+		ders = append(ders, data)
+	}
+	var crls []*x509.RevocationList
+	for _, der := range ders {
+		crl, err := x509.ParseRevocationList(der)
+		if err != nil {
+			return nil, fmt.Errorf("CRL file %s: %w", file, err)
+		}
+		crls = append(crls, crl)
+	}
+	return crls, nil
+}
+
+// verifyCertificate verifies the chain sent by the server for host, then
+// checks that no certificate of it is revoked by crls. It returns the
+// verified chain, from the leaf to the root.
+func verifyCertificate(certs []*x509.Certificate, roots *x509.CertPool, crls []*x509.RevocationList, host string) ([]*x509.Certificate, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("server sent no certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       host,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	chains, err := certs[0].Verify(opts)
+	if err != nil {
+		return nil, describeVerifyError(certs[0], host, err)
+	}
+
+	// Any chain without a revoked certificate will do
+	for _, chain := range chains {
+		if err = checkRevocation(chain, crls); err == nil {
+			return chain, nil
+		}
+	}
+	return nil, err
+}
+
+// verifyOCSPStaple checks the OCSP response stapled for the leaf of chain:
+// it must be signed for the issuer, be current and say the certificate is
+// good.
+func verifyOCSPStaple(staple []byte, chain []*x509.Certificate, infof func(format string, args ...interface{})) error {
+	if len(staple) == 0 {
+		return ErrOCSPStapleMissing
+	}
+	if len(chain) < 2 {
+		return errors.New("the issuer of the server certificate is needed to check its OCSP response")
+	}
+	leaf, issuer := chain[0], chain[1]
+	resp, err := ocsp.ParseResponseForCert(staple, leaf, issuer)
+	if err != nil {
+		return fmt.Errorf("invalid stapled OCSP response for %q: %w", certificateName(leaf), err)
+	}
+
+	now := time.Now()
+	if resp.ThisUpdate.After(now.Add(ocspClockSkew)) {
+		return fmt.Errorf("stapled OCSP response for %q is from the future (%s)",
+			certificateName(leaf), resp.ThisUpdate.Format(time.RFC3339))
+	}
+	if !resp.NextUpdate.IsZero() && resp.NextUpdate.Add(ocspClockSkew).Before(now) {
+		return fmt.Errorf("stapled OCSP response for %q is stale, its next update was %s",
+			certificateName(leaf), resp.NextUpdate.Format(time.RFC3339))
+	}
+
+	switch resp.Status {
+	case ocsp.Good:
+		infof("SSL certificate status: good, updated %s", resp.ThisUpdate.Format(time.RFC3339))
+		return nil
+	case ocsp.Revoked:
+		infof("SSL certificate status: revoked")
+		return &CertificateError{
+			Subject: certificateName(leaf),
+			Reason:  "was revoked on " + resp.RevokedAt.Format(time.DateOnly) + " according to its OCSP response",
+		}
+	}
+	infof("SSL certificate status: unknown")
+	return &CertificateError{
+		Subject: certificateName(leaf),
+		Reason:  "has an unknown status in its OCSP response",
+	}
+}
+
+// checkRevocation looks up every certificate of chain in the CRLs signed by
+// its issuer.
+func checkRevocation(chain []*x509.Certificate, crls []*x509.RevocationList) error {
+	for i := 0; i+1 < len(chain); i++ {
+		cert, issuer := chain[i], chain[i+1]
+		for _, crl := range crls {
+			if !bytes.Equal(crl.RawIssuer, issuer.RawSubject) || crl.CheckSignatureFrom(issuer) != nil {
+				continue
+			}
+			for _, entry := range crl.RevokedCertificateEntries {
+				if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+					return &CertificateError{
+						Subject: certificateName(cert),
+						Reason: fmt.Sprintf("was revoked on %s by %q",
+							entry.RevocationTime.Format(time.DateOnly), issuer.Subject),
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// describeVerifyError turns an x509 verification error into a
+// CertificateError.
+func describeVerifyError(leaf *x509.Certificate, host string, err error) error {
+	certErr := &CertificateError{Subject: certificateName(leaf), Reason: err.Error(), Err: err}
+
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	switch {
+	case errors.As(err, &unknownAuthority):
+		cert := leaf
+		if unknownAuthority.Cert != nil {
+			cert = unknownAuthority.Cert
+		}
+		certErr.Subject = certificateName(cert)
+		certErr.Reason = fmt.Sprintf("is issued by %q, which isn't a trusted authority", cert.Issuer)
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			certErr.Reason = "is self-signed and not trusted"
+		}
+	case errors.As(err, &invalid):
+		cert := invalid.Cert
+		certErr.Subject = certificateName(cert)
+		switch invalid.Reason {
+		case x509.Expired:
+			if time.Now().Before(cert.NotBefore) {
+				certErr.Reason = "is not valid before " + cert.NotBefore.Format(time.RFC3339)
+			} else {
+				certErr.Reason = "expired on " + cert.NotAfter.Format(time.RFC3339)
+			}
+		case x509.NotAuthorizedToSign:
+			certErr.Reason = "signed other certificates but isn't a CA"
+		case x509.IncompatibleUsage:
+			certErr.Reason = "isn't valid for server authentication"
+		}
+	case errors.As(err, &hostname):
+		names := hostname.Certificate.DNSNames
+		for _, ip := range hostname.Certificate.IPAddresses {
+			names = append(names, ip.String())
+		}
+		if len(names) == 0 {
+			certErr.Reason = fmt.Sprintf("has no subject alternative names, so isn't valid for %s", host)
+		} else {
+			certErr.Reason = fmt.Sprintf("is valid for %s, not %s", strings.Join(names, ", "), host)
+		}
+	}
+	return certErr
+}
+
+// certificateName is the subject of cert, or its first name when the
+// subject is empty.
+func certificateName(cert *x509.Certificate) string {
+	if name := cert.Subject.String(); name != "" {
+		return name
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return "serial " + cert.SerialNumber.String()
+}
+
+// ocspClockSkew is the clock difference allowed with OCSP responders.
+const ocspClockSkew = 5 * time.Minute
+
+// parsePinnedPubKey returns the sha256 hashes of the pinned public keys,
+// given either as sha256//<base64> hashes or as a PEM or DER key file.
+func parsePinnedPubKey(spec string) ([][]byte, error) {
+	if strings.HasPrefix(spec, "sha256//") {
+		var pins [][]byte
+		for _, pin := range strings.Split(spec, ";") {
+			pin = strings.TrimSpace(pin)
+			if !strings.HasPrefix(pin, "sha256//") {
+				return nil, fmt.Errorf("invalid pinned public key hash %q", pin)
+			}
+			sum, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, "sha256//"))
+			if err != nil || len(sum) != sha256.Size {
+				return nil, fmt.Errorf("invalid pinned public key hash %q", pin)
+			}
+			pins = append(pins, sum)
+		}
+		return pins, nil
+	}
+
+	der, err := os.ReadFile(spec)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(der); block != nil {
+		der = block.Bytes
+	}
+	if _, err := x509.ParsePKIXPublicKey(der); err != nil {
+		return nil, fmt.Errorf("%s is not a public key: %w", spec, err)
+	}
+	sum := sha256.Sum256(der)
+	return [][]byte{sum[:]}, nil
+}
+
+// verifyPinnedPubKey checks the public key of the leaf certificate against
+// the pinned hashes.
+func verifyPinnedPubKey(pins [][]byte, state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return ErrPinnedPubKey
+	}
+	sum := sha256.Sum256(state.PeerCertificates[0].RawSubjectPublicKeyInfo)
+	for _, pin := range pins {
+		if bytes.Equal(pin, sum[:]) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w (sha256//%s)", ErrPinnedPubKey, base64.StdEncoding.EncodeToString(sum[:]))
+}
@@ -0,0 +1,508 @@
+package src
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/crypto/ocsp"
+)
+
+// writeTestCertificate creates a self-signed certificate for 127.0.0.1 and
+// localhost, usable by servers and clients, and writes it and its key as
+// PEM files named after name.
+func writeTestCertificate(t *testing.T, name string) (tls.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+"-key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, certFile, keyFile
+}
+
+// newTestServers serves handler over TLS with config, on TCP for HTTP/1.1
+// and HTTP/2 and on UDP for HTTP/3, and returns the url of each.
+func newTestServers(t *testing.T, config *tls.Config, handler http.Handler) (tcpURL, h3URL string) {
+	t.Helper()
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	server.TLS = config.Clone()
+	if server.TLS.NextProtos == nil {
+		server.TLS.NextProtos = []string{"h2", "http/1.1"}
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h3 := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(config.Clone()),
+		Handler:   handler,
+	}
+	go h3.Serve(udp)
+	t.Cleanup(func() {
+		h3.Close()
+		udp.Close()
+	})
+	return server.URL, "https://" + udp.LocalAddr().String()
+}
+
+func TestPinnedPubKey(t *testing.T) {
+	cert, _, _ := writeTestCertificate(t, "pinned")
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}
+	sum := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	hash := "sha256//" + base64.StdEncoding.EncodeToString(sum[:])
+
+	keyFile := filepath.Join(t.TempDir(), "pub.pem")
+	pub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: leaf.RawSubjectPublicKeyInfo})
+	if err := os.WriteFile(keyFile, pub, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	other := "sha256//" + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+	for spec, match := range map[string]bool{
+		hash:               true,
+		other + ";" + hash: true,
+		keyFile:            true,
+		other:              false,
+	} {
+		pins, err := parsePinnedPubKey(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = verifyPinnedPubKey(pins, state)
+		if match && err != nil || !match && !errors.Is(err, ErrPinnedPubKey) {
+			t.Errorf("pin %s: %v", spec, err)
+		}
+	}
+
+	if _, err := parsePinnedPubKey("sha256//notbase64"); err == nil {
+		t.Error("invalid hash should be rejected")
+	}
+}
+
+// issueTestCertificate creates a server certificate for 127.0.0.1 and
+// localhost signed by ca.
+func issueTestCertificate(t *testing.T, ca tls.Certificate, name string, serial int64) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Leaf, &key.PublicKey, ca.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestCustomTrustRoots(t *testing.T) {
+	ca, caFile, _ := writeTestCertificate(t, "Test CA")
+	serverCert := issueTestCertificate(t, ca, "server", 42)
+
+	dir := t.TempDir()
+	caPath := filepath.Join(dir, "certs")
+	caPEM, _ := os.ReadFile(caFile)
+	os.Mkdir(caPath, 0o700)
+	os.WriteFile(filepath.Join(caPath, "README"), []byte("not a certificate"), 0o600)
+	os.WriteFile(filepath.Join(caPath, "0a1b2c3d.0"), caPEM, 0o600)
+
+	crlDER, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: big.NewInt(42), RevocationTime: time.Now().Add(-time.Minute)},
+		},
+	}, ca.Leaf, ca.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crlFile := filepath.Join(dir, "ca.crl")
+	os.WriteFile(crlFile, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crlDER}), 0o600)
+	emptyCRLDER, _ := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number: big.NewInt(2), ThisUpdate: time.Now(), NextUpdate: time.Now().Add(time.Hour),
+	}, ca.Leaf, ca.PrivateKey.(*ecdsa.PrivateKey))
+	emptyCRLFile := filepath.Join(dir, "empty.crl")
+	os.WriteFile(emptyCRLFile, emptyCRLDER, 0o600)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	tcpURL, h3URL := newTestServers(t, &tls.Config{Certificates: []tls.Certificate{serverCert}}, handler)
+
+	targets := map[string]string{
+		"1.1": tcpURL,
+		"2":   tcpURL,
+		"3":   h3URL,
+	}
+	for version, target := range targets {
+		for name, c := range map[string]*Client{
+			"cacert":    NewClient().SetCACert(caFile),
+			"capath":    NewClient().SetCAPath(caPath),
+			"empty crl": NewClient().SetCACert(caFile).SetCRLFile(emptyCRLFile),
+		} {
+			resp, err := c.SetHTTPVersion(version).Get(target)
+			if err != nil {
+				t.Errorf("HTTP/%s %s: %v", version, name, err)
+			} else if string(resp.Body) != "ok" {
+				t.Errorf("HTTP/%s %s: unexpected body %q", version, name, resp.Body)
+			}
+		}
+
+		for reason, c := range map[string]*Client{
+			`is issued by "CN=Test CA", which isn't a trusted authority`: NewClient(),
+			`was revoked on`: NewClient().SetCACert(caFile).SetCRLFile(crlFile),
+		} {
+			_, err := c.SetHTTPVersion(version).Get(target)
+			var certErr *CertificateError
+			if !errors.As(err, &certErr) {
+				t.Errorf("HTTP/%s: expected a CertificateError, got %v", version, err)
+				continue
+			}
+			if certErr.Subject != "CN=server" || !strings.HasPrefix(certErr.Reason, reason) {
+				t.Errorf("HTTP/%s: unexpected error %v", version, certErr)
+			}
+		}
+	}
+}
+
+func TestVerifyCertificateErrors(t *testing.T) {
+	ca, _, _ := writeTestCertificate(t, "Test CA")
+	leaf := issueTestCertificate(t, ca, "server", 7).Leaf
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+
+	_, err := verifyCertificate([]*x509.Certificate{leaf}, roots, nil, "example.com")
+	expected := `certificate "CN=server" is valid for localhost, 127.0.0.1, not example.com`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+	var hostErr x509.HostnameError
+	if !errors.As(err, &hostErr) {
+		t.Error("the x509 error should be wrapped")
+	}
+
+	_, err = verifyCertificate([]*x509.Certificate{ca.Leaf}, nil, nil, "localhost")
+	expected = `certificate "CN=Test CA" is self-signed and not trusted`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+}
+
+func TestHandshakeOptions(t *testing.T) {
+	serverCert, _, _ := writeTestCertificate(t, "server")
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(tls.VersionName(r.TLS.Version) + " " + tls.CipherSuiteName(r.TLS.CipherSuite) +
+			" " + r.TLS.NegotiatedProtocol))
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		NextProtos:   []string{"http/1.1"},
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	tests := map[string]struct {
+		client   *Client
+		expected string
+	}{
+		"tls 1.2 cipher": {
+			NewClient().SetTLSVersion(0, tls.VersionTLS12).SetCiphers("ECDHE-ECDSA-AES128-SHA"),
+			"TLS 1.2 TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA http/1.1",
+		},
+		"no alpn": {
+			NewClient().SetTLSVersion(0, tls.VersionTLS12).SetNoALPN(true).
+				SetCiphers("TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384").SetCurves("P-384"),
+			"TLS 1.2 TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 ",
+		},
+	}
+	for name, test := range tests {
+		resp, err := test.client.SetInsecure(true).Get(server.URL)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if string(resp.Body) != test.expected {
+			t.Errorf("%s: expected %q, got %q", name, test.expected, resp.Body)
+		}
+	}
+
+	// The TLS 1.3 suite depends on hardware support for AES
+	resp, err := NewClient().SetInsecure(true).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := string(resp.Body); !strings.HasPrefix(body, "TLS 1.3 ") || !strings.HasSuffix(body, " http/1.1") {
+		t.Errorf("defaults: unexpected handshake %q", body)
+	}
+
+	server.TLS.MinVersion = tls.VersionTLS13
+	if _, err := NewClient().SetInsecure(true).SetTLSVersion(0, tls.VersionTLS12).Get(server.URL); err == nil {
+		t.Error("a TLS 1.3 only server should reject TLS 1.2")
+	}
+}
+
+func TestHandshakeOptionErrors(t *testing.T) {
+	if ids, err := parseCiphers("ECDHE-RSA-AES128-GCM-SHA256:TLS_RSA_WITH_3DES_EDE_CBC_SHA"); err != nil ||
+		len(ids) != 2 || ids[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 || ids[1] != tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA {
+		t.Errorf("unexpected ciphers %v, %v", ids, err)
+	}
+	for _, list := range []string{"NOPE-SHA", "TLS_AES_128_GCM_SHA256"} {
+		if _, err := parseCiphers(list); err == nil {
+			t.Errorf("ciphers %s should be rejected", list)
+		}
+	}
+	if err := checkTLS13Ciphers("TLS_CHACHA20_POLY1305_SHA256:TLS_AES_256_GCM_SHA384:TLS_AES_128_GCM_SHA256"); err != nil {
+		t.Error(err)
+	}
+	if err := checkTLS13Ciphers("TLS_AES_256_GCM_SHA384"); err == nil {
+		t.Error("a restricted TLS 1.3 cipher list can't be honored")
+	}
+	if curves, err := parseCurves("x25519,prime256v1"); err != nil || len(curves) != 2 || curves[1] != tls.CurveP256 {
+		t.Errorf("unexpected curves %v, %v", curves, err)
+	}
+	if _, err := parseCurves("brainpoolP256r1"); err == nil {
+		t.Error("unsupported curve should be rejected")
+	}
+
+	for _, test := range []struct {
+		version string
+		opts    tlsOptions
+		ok      bool
+	}{
+		{"1.1", tlsOptions{maxVersion: tls.VersionTLS10, noALPN: true}, true},
+		{"2", tlsOptions{maxVersion: tls.VersionTLS12}, true},
+		{"2", tlsOptions{maxVersion: tls.VersionTLS11}, false},
+		{"2", tlsOptions{noALPN: true}, false},
+		{"3", tlsOptions{maxVersion: tls.VersionTLS12}, false},
+		{"3", tlsOptions{ciphers: "AES128-SHA"}, false},
+	} {
+		if err := test.opts.checkHTTPVersion(test.version); (err == nil) != test.ok {
+			t.Errorf("HTTP/%s with %+v: %v", test.version, test.opts, err)
+		}
+	}
+	_, err := NewClient().SetHTTPVersion("3").SetTLSVersion(0, tls.VersionTLS12).Get("https://127.0.0.1:1/")
+	if err == nil || !strings.Contains(err.Error(), "HTTP/3 needs TLS 1.3") {
+		t.Errorf("HTTP/3 below TLS 1.3 should fail before connecting, got %v", err)
+	}
+}
+
+func TestPinnedPubKeyAllVersions(t *testing.T) {
+	serverCert, _, _ := writeTestCertificate(t, "server")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	tcpURL, h3URL := newTestServers(t, &tls.Config{Certificates: []tls.Certificate{serverCert}}, handler)
+
+	proxy := authProxy(t)
+	defer proxy.Close()
+
+	sum := sha256.Sum256(serverCert.Leaf.RawSubjectPublicKeyInfo)
+	pin := "sha256//" + base64.StdEncoding.EncodeToString(sum[:])
+	wrongPin := "sha256//" + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	for _, test := range []struct {
+		version, target, proxy string
+	}{
+		{"1.1", tcpURL, ""},
+		{"2", tcpURL, ""},
+		{"3", h3URL, ""},
+		{"1.1", tcpURL, "http://user:pass@" + proxy.Addr().String()},
+		{"2", tcpURL, "http://user:pass@" + proxy.Addr().String()},
+	} {
+		newClient := func() *Client {
+			c := NewClient().SetHTTPVersion(test.version).SetInsecure(true)
+			if test.proxy != "" {
+				c.SetProxy(test.proxy)
+			}
+			return c
+		}
+		if _, err := newClient().SetPinnedPubKey(wrongPin + ";" + pin).Get(test.target); err != nil {
+			t.Errorf("HTTP/%s %s: matching pin failed: %v", test.version, test.proxy, err)
+		}
+		_, err := newClient().SetPinnedPubKey(wrongPin).Get(test.target)
+		if !errors.Is(err, ErrPinnedPubKey) {
+			t.Errorf("HTTP/%s %s: wrong pin should fail with ErrPinnedPubKey, got %v", test.version, test.proxy, err)
+		}
+	}
+}
+
+func TestCertStatus(t *testing.T) {
+	ca, caFile, _ := writeTestCertificate(t, "Test CA")
+	other, _, _ := writeTestCertificate(t, "Other CA")
+	serverCert := issueTestCertificate(t, ca, "server", 42)
+
+	staple := func(signer tls.Certificate, status int, nextUpdate time.Time) []byte {
+		resp, err := ocsp.CreateResponse(ca.Leaf, signer.Leaf, ocsp.Response{
+			Status:       status,
+			SerialNumber: big.NewInt(42),
+			ThisUpdate:   time.Now().Add(-time.Hour),
+			NextUpdate:   nextUpdate,
+			RevokedAt:    time.Now().Add(-time.Hour),
+		}, signer.PrivateKey.(*ecdsa.PrivateKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	tomorrow, yesterday := time.Now().Add(24*time.Hour), time.Now().Add(-24*time.Hour)
+
+	tests := map[string]struct {
+		staple []byte
+		err    string
+	}{
+		"good":    {staple(ca, ocsp.Good, tomorrow), ""},
+		"revoked": {staple(ca, ocsp.Revoked, tomorrow), `certificate "CN=server" was revoked on`},
+		"stale":   {staple(ca, ocsp.Good, yesterday), "is stale"},
+		"forged":  {staple(other, ocsp.Good, tomorrow), "invalid stapled OCSP response"},
+		"missing": {nil, ErrOCSPStapleMissing.Error()},
+	}
+	for name, test := range tests {
+		cert := serverCert
+		cert.OCSPStaple = test.staple
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}))
+		server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+		server.StartTLS()
+
+		var verbose bytes.Buffer
+		_, err := NewClient().SetCACert(caFile).SetCertStatus(true).SetVerbose(&verbose).Get(server.URL)
+		server.Close()
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: %v", name, err)
+			} else if !strings.Contains(verbose.String(), "* SSL certificate status: good") {
+				t.Errorf("%s: verbose output should show the OCSP status, got %q", name, verbose.String())
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected %q, got %v", name, test.err, err)
+		}
+	}
+}
+
+func TestKeyLogAndHandshakeDetails(t *testing.T) {
+	serverCert, _, _ := writeTestCertificate(t, "server")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	tcpURL, h3URL := newTestServers(t, &tls.Config{Certificates: []tls.Certificate{serverCert}}, handler)
+
+	dir := t.TempDir()
+	envKeyLog := filepath.Join(dir, "env.log")
+	t.Setenv("SSLKEYLOGFILE", envKeyLog)
+
+	for version, target := range map[string]string{
+		"1.1": tcpURL,
+		"2":   tcpURL,
+		"3":   h3URL,
+	} {
+		keyLog := filepath.Join(dir, version+".log")
+		var verbose bytes.Buffer
+		c := NewClient().SetHTTPVersion(version).SetInsecure(true).SetKeyLogFile(keyLog).SetVerbose(&verbose)
+		// A second request opens a new connection and resumes the session
+		for i := 0; i < 2; i++ {
+			if _, err := c.Get(target); err != nil {
+				t.Fatalf("HTTP/%s: %v", version, err)
+			}
+		}
+		if data, _ := os.ReadFile(keyLog); !bytes.Contains(data, []byte("CLIENT_HANDSHAKE_TRAFFIC_SECRET ")) {
+			t.Errorf("HTTP/%s: no TLS secrets in the key log", version)
+		}
+
+		alpn := map[string]string{"1.1": "http/1.1", "2": "h2", "3": "h3"}[version]
+		for _, line := range []string{
+			"* TLS 1.3 connection to 127.0.0.1 using ",
+			", ALPN " + alpn + ", new session\n",
+			", ALPN " + alpn + ", resumed session\n",
+			"*  0 subject: CN=server\n",
+			"*    issuer: CN=server\n",
+			"*    SANs: localhost, 127.0.0.1\n",
+			"*    expires: " + serverCert.Leaf.NotAfter.UTC().Format(time.RFC3339),
+		} {
+			if !strings.Contains(verbose.String(), line) {
+				t.Errorf("HTTP/%s: verbose output is missing %q:\n%s", version, line, verbose.String())
+			}
+		}
+	}
+
+	if _, err := NewClient().SetInsecure(true).Get(tcpURL); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(envKeyLog); !bytes.Contains(data, []byte("CLIENT_HANDSHAKE_TRAFFIC_SECRET ")) {
+		t.Error("SSLKEYLOGFILE should be used without a key log file")
+	}
+}
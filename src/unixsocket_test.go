@@ -0,0 +1,65 @@
+package src
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestUnixSocket(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var session string
+		if cookie, err := r.Cookie("session"); err == nil {
+			session = cookie.Value
+		}
+		fmt.Fprintf(w, "%s %s %s %s %s", r.Proto, r.Host, r.Header.Get("X-Test"), session, body)
+	})
+	serve := func(t *testing.T, name string) {
+		listener, err := net.Listen("unix", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := &http.Server{Handler: h2c.NewHandler(handler, &http2.Server{})}
+		go server.Serve(listener)
+		t.Cleanup(func() { server.Close() })
+	}
+
+	path := filepath.Join(t.TempDir(), "gurl.sock")
+	serve(t, path)
+	for version, proto := range map[string]string{"1.1": "HTTP/1.1", "2": "HTTP/2.0"} {
+		resp, err := NewClient().SetUnixSocket(path).SetHTTPVersion(version).
+			AddHeader("X-Test", "header").AddCookie("session", "cookie").
+			AddBodyBytes([]byte("body")).Post("http://daemon.local/v1/info")
+		if err != nil {
+			t.Fatalf("HTTP/%s: %v", version, err)
+		}
+		if want := proto + " daemon.local header cookie body"; string(resp.Body) != want {
+			t.Errorf("HTTP/%s got %q, want %q", version, resp.Body, want)
+		}
+	}
+	if _, err := NewClient().SetUnixSocket(path).SetHTTPVersion("3").Get("https://daemon.local"); err != ErrHTTP3UnixSocket {
+		t.Errorf("HTTP/3 got %v, want %v", err, ErrHTTP3UnixSocket)
+	}
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	name := "gurl-test-" + filepath.Base(t.TempDir())
+	serve(t, "@"+name)
+	resp, err := NewClient().SetAbstractUnixSocket(name).Get("http://daemon.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(resp.Body), "HTTP/1.1 daemon.local") {
+		t.Errorf("abstract socket got %q", resp.Body)
+	}
+}
@@ -20,7 +20,7 @@ echo "4. Testing that auth headers are properly sent (using GET endpoint that ec
 ./gURL GET https://httpbin.org/get --basic --user testuser:testpass | grep -A 10 '"headers"'
 echo
 
-echo "5. Testing digest authentication flag (will show 401 with digest challenge - full digest auth requires challenge-response):"
+echo "5. Testing Digest Authentication (challenge-response):"
 ./gURL GET https://httpbin.org/digest-auth/auth/user/pass --digest --user user:pass
 echo
 